@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/concat"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/jobs"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/safepath"
+)
+
+type (
+	downloadTask struct {
+		file     archive.FileInfo
+		destPath string
+		err      error
+	}
+	downloadOutcome struct {
+		skipped bool
+		err     error
+	}
+	FileError struct {
+		Name  string `json:"name"`
+		Error string `json:"error"`
+	}
+	// ConcatReport says which backend joined a concatenated file, whether it
+	// was stream copied or re-encoded, and why.
+	ConcatReport struct {
+		Output string `json:"output"`
+		concat.Plan
+		Chapters []ChapterReport `json:"chapters,omitempty"`
+	}
+	ChapterReport struct {
+		Title        string  `json:"title"`
+		StartSeconds float64 `json:"start_seconds"`
+		Start        string  `json:"start"`
+	}
+)
+
+func (d *Delegate) addDownloadTool() {
+	mcp.AddTool(d.server, &mcp.Tool{
+		Name:        "download_audio",
+		Description: "Download audio files from an Internet Archive item according to configured format preferences",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args DownloadArgs) (*mcp.CallToolResult, any, error) {
+		response, err := d.downloadItem(ctx, args, newProgressReporter(ctx, req))
+		if response == nil {
+			return errorResult("Download failed: %s", describeError(err)), nil, nil
+		}
+
+		result := jsonResult(response, "response")
+		if err != nil {
+			result.IsError = true
+		}
+		return result, nil, nil
+	})
+}
+
+// downloadItem runs the whole download pipeline for one item. It returns a nil
+// response for failures that happen before any file is attempted, and a
+// response together with an error when every selected file failed.
+func (d *Delegate) downloadItem(ctx context.Context, args DownloadArgs, observer downloadObserver) (map[string]interface{}, error) {
+	if err := archive.ValidateIdentifier(args.Identifier); err != nil {
+		return nil, err
+	}
+	if args.ConcatFormat != "" && !slices.Contains(concat.ChapterFormats, args.ConcatFormat) {
+		return nil, fmt.Errorf("concat_format must be %s, got %q", strings.Join(concat.ChapterFormats, " or "), args.ConcatFormat)
+	}
+
+	metadata, err := d.client.GetMetadataContext(ctx, args.Identifier)
+	var itemErr *archive.ItemError
+	if errors.As(err, &itemErr) {
+		return nil, fmt.Errorf("cannot download %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+
+	if err := d.client.LicensePolicy().Check(metadata.Metadata); err != nil {
+		return nil, err
+	}
+
+	destDir, err := safepath.Join(d.cfg.DownloadDirectory, args.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	var tasks []downloadTask
+	var authRequired []string
+	for _, file := range archive.SelectAudioFiles(metadata.Files, d.cfg.AudioFormatPreference, args.AllFormats) {
+		destPath, err := safepath.Join(destDir, file.Name)
+		if err == nil && file.RequiresAuth() && !d.client.HasCredentials() {
+			err = fmt.Errorf("%s is only available to logged-in accounts: %w", file.Name, archive.ErrNoCredentials)
+		}
+		if file.RequiresAuth() {
+			authRequired = append(authRequired, file.Name)
+		}
+		tasks = append(tasks, downloadTask{file: file, destPath: destPath, err: err})
+	}
+
+	downloadedFiles, skippedFiles, failedFiles := d.downloadFiles(ctx, args.Identifier, tasks, observer)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("download of %s cancelled: %w", args.Identifier, err)
+	}
+
+	response := map[string]interface{}{
+		"identifier":       args.Identifier,
+		"download_dir":     destDir,
+		"downloaded_files": downloadedFiles,
+		"skipped_files":    skippedFiles,
+	}
+
+	if len(authRequired) > 0 {
+		response["auth_required_files"] = authRequired
+	}
+
+	if len(failedFiles) > 0 {
+		response["failed_files"] = failedFiles
+		response["partial"] = len(downloadedFiles)+len(skippedFiles) > 0
+	}
+
+	localFiles := append(append([]string(nil), downloadedFiles...), skippedFiles...)
+	tracks := make(map[string]concat.TrackInfo, len(tasks))
+	durations := make(map[string]time.Duration, len(tasks))
+	for _, task := range tasks {
+		tracks[task.file.Name] = concat.TrackInfo{Disc: task.file.Disc, Track: task.file.Track, Title: task.file.Title}
+		durations[task.file.Name] = task.file.Duration()
+	}
+	detector := d.detector
+	if args.ConcatFormat != "" {
+		chaptered := *d.detector
+		chaptered.TitlesAsChapters = true
+		detector = &chaptered
+	}
+	multiPartSets := detector.Detect(localFiles, tracks)
+
+	if len(multiPartSets) > 0 {
+		shouldConcat := false
+		if args.Concat != nil {
+			shouldConcat = *args.Concat
+		} else {
+			for _, set := range multiPartSets {
+				if len(set.Files) >= d.cfg.ConcatAskThreshold {
+					response["multi_part_detected"] = true
+					response["multi_part_sets"] = multiPartSets
+					response["suggestion"] = fmt.Sprintf("Found %d multi-part file sets. Check the order of their Files, then re-run with concat=true to concatenate them.", len(multiPartSets))
+					break
+				}
+			}
+		}
+
+		if shouldConcat {
+			response["multi_part_sets"] = multiPartSets
+		}
+
+		if shouldConcat && len(failedFiles) > 0 {
+			response["concat_error"] = fmt.Sprintf("Skipped concatenation because %d files failed to download", len(failedFiles))
+		} else if shouldConcat {
+			if concatenator, err := d.cfg.Concatenator(); err != nil {
+				response["concat_error"] = fmt.Sprintf("Concatenation not available: %v", err)
+			} else {
+				var concatenatedFiles []string
+				var concatPlans []ConcatReport
+				for _, set := range multiPartSets {
+					outputName := set.OutputName
+					if args.ConcatFormat != "" {
+						outputName = strings.TrimSuffix(outputName, path.Ext(outputName)) + "." + args.ConcatFormat
+					}
+					outputPath, err := safepath.Join(destDir, outputName)
+					if err != nil {
+						response["concat_error"] = fmt.Sprintf("Failed to concatenate %s: %v", outputName, err)
+						break
+					}
+
+					var fullPaths, titles []string
+					var partDurations []time.Duration
+					var inputBytes int64
+					for _, file := range set.Files {
+						fullPath := filepath.Join(destDir, filepath.FromSlash(file))
+						fullPaths = append(fullPaths, fullPath)
+						titles = append(titles, tracks[file].Title)
+						partDurations = append(partDurations, durations[file])
+						if info, err := os.Stat(fullPath); err == nil {
+							inputBytes += info.Size()
+						}
+					}
+
+					report := ConcatReport{Output: outputName}
+					progress := observer.concat(outputName, inputBytes)
+					if args.ConcatFormat == "" {
+						report.Plan, err = concatenator.Concatenate(ctx, fullPaths, outputPath, progress)
+					} else {
+						var chapters []concat.Chapter
+						chapters, err = concat.Chapters(fullPaths, titles, partDurations)
+						if err == nil {
+							list := concat.ChapterList{Title: metadata.Metadata.Title.First(), Artist: metadata.Metadata.Creator.First(), Chapters: chapters}
+							report.Plan, err = concatenator.Chapterize(ctx, fullPaths, outputPath, list, progress)
+							report.Chapters = chapterReports(chapters)
+						}
+					}
+					if err != nil {
+						response["concat_error"] = fmt.Sprintf("Failed to concatenate %s: %v", outputName, err)
+						break
+					}
+					observer.concatDone(outputName, inputBytes)
+
+					concatenatedFiles = append(concatenatedFiles, outputName)
+					concatPlans = append(concatPlans, report)
+
+					for _, file := range fullPaths {
+						_ = os.Remove(file)
+					}
+				}
+
+				if len(concatenatedFiles) > 0 {
+					response["concatenated_files"] = concatenatedFiles
+					response["downloaded_files"] = concatenatedFiles
+					response["concat_plans"] = concatPlans
+				}
+			}
+		}
+	}
+
+	if len(failedFiles) > 0 && len(downloadedFiles)+len(skippedFiles) == 0 {
+		return response, fmt.Errorf("all %d files failed to download", len(failedFiles))
+	}
+
+	return response, nil
+}
+
+func chapterReports(chapters []concat.Chapter) []ChapterReport {
+	reports := make([]ChapterReport, 0, len(chapters))
+	for _, chapter := range chapters {
+		reports = append(reports, ChapterReport{
+			Title:        chapter.Title,
+			StartSeconds: chapter.Start.Seconds(),
+			Start:        humanDuration(chapter.Start),
+		})
+	}
+	return reports
+}
+
+func (d *Delegate) downloadFiles(ctx context.Context, identifier string, tasks []downloadTask, observer downloadObserver) ([]string, []string, []FileError) {
+	files := make([]archive.FileInfo, 0, len(tasks))
+	for _, task := range tasks {
+		files = append(files, task.file)
+	}
+	observer.begin(files)
+
+	outcomes := make([]downloadOutcome, len(tasks))
+	queue := make(chan int)
+
+	workers := min(max(d.cfg.DownloadConcurrency, 1), max(len(tasks), 1))
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				outcomes[i] = d.downloadOne(ctx, identifier, tasks[i], observer)
+			}
+		}()
+	}
+
+	for i := range tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	var downloaded, skipped []string
+	var failed []FileError
+	for i, outcome := range outcomes {
+		name := tasks[i].file.Name
+		switch {
+		case outcome.err != nil:
+			failed = append(failed, FileError{Name: name, Error: describeError(outcome.err)})
+		case outcome.skipped:
+			skipped = append(skipped, name)
+		default:
+			downloaded = append(downloaded, name)
+		}
+	}
+
+	return downloaded, skipped, failed
+}
+
+func (d *Delegate) downloadOne(ctx context.Context, identifier string, task downloadTask, observer downloadObserver) downloadOutcome {
+	if err := ctx.Err(); err != nil {
+		return downloadOutcome{err: err}
+	}
+
+	if task.err != nil {
+		observer.fileFailed(task.file.Name, task.err)
+		return downloadOutcome{err: task.err}
+	}
+
+	size := task.file.SizeBytes()
+
+	exists, err := verifiedCopyExists(task.destPath, task.file)
+	if err != nil {
+		err = fmt.Errorf("failed to check file: %w", err)
+		observer.fileFailed(task.file.Name, err)
+		return downloadOutcome{err: err}
+	}
+	if exists {
+		observer.fileDone(task.file.Name, size, true)
+		return downloadOutcome{skipped: true}
+	}
+
+	if err := safepath.MkdirAll(task.destPath); err != nil {
+		observer.fileFailed(task.file.Name, err)
+		return downloadOutcome{err: err}
+	}
+
+	if err := d.client.DownloadContext(ctx, identifier, task.file, task.destPath, observer.file(task.file.Name)); err != nil {
+		// Only a job stopped by shutdown comes back for its partial file.
+		if !errors.Is(context.Cause(ctx), jobs.ErrShutdown) {
+			_ = os.Remove(archive.PartialPath(task.destPath))
+		}
+		observer.fileFailed(task.file.Name, err)
+		return downloadOutcome{err: err}
+	}
+
+	observer.fileDone(task.file.Name, size, false)
+	return downloadOutcome{}
+}
+
+// verifiedCopyExists reports whether path already holds file intact. Copies
+// that fail verification are downloaded again; files without checksums are
+// kept when their size matches, and downloaded again when it is unknown.
+func verifiedCopyExists(path string, file archive.FileInfo) (bool, error) {
+	err := archive.VerifyFile(path, file)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, archive.ErrNoChecksums):
+		// VerifyFile has already compared the size when it is published.
+		return file.SizeBytes() > 0, nil
+	case os.IsNotExist(err), errors.Is(err, archive.ErrChecksumMismatch):
+		return false, nil
+	default:
+		return false, err
+	}
+}
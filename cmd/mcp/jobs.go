@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/concat"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/jobs"
+)
+
+const jobStateFile = ".mcp-internet-archive-jobs.json"
+
+type (
+	JobArgs struct {
+		JobID string `json:"job_id" jsonschema:"Download job ID returned by start_download"`
+	}
+	ListDownloadsArgs struct {
+		State string `json:"state,omitempty" jsonschema:"Only list jobs in this state: queued, running, done, failed or cancelled"`
+	}
+	JobStatus struct {
+		jobs.Job
+		BytesDone  int64 `json:"bytes_done"`
+		BytesTotal int64 `json:"bytes_total"`
+	}
+	jobObserver struct {
+		update jobs.Updater
+	}
+)
+
+func (d *Delegate) startJobs() error {
+	statePath := filepath.Join(d.cfg.DownloadDirectory, jobStateFile)
+	manager, err := jobs.NewManager(d.ctx, statePath, d.cfg.JobConcurrency, d.runDownloadJob)
+	if err != nil {
+		return fmt.Errorf("failed to start download jobs: %w", err)
+	}
+	d.jobs = manager
+	return nil
+}
+
+func (d *Delegate) runDownloadJob(ctx context.Context, job jobs.Job, update jobs.Updater) (any, error) {
+	var args DownloadArgs
+	if err := json.Unmarshal(job.Params, &args); err != nil {
+		return nil, fmt.Errorf("invalid job parameters: %w", err)
+	}
+
+	response, err := d.downloadItem(ctx, args, &jobObserver{update: update})
+	if hint := errorHint(err); hint != "" {
+		err = fmt.Errorf("%w. %s", err, hint)
+	}
+	if response == nil {
+		return nil, err
+	}
+	return response, err
+}
+
+func (d *Delegate) addJobTools() {
+	mcp.AddTool(d.server, &mcp.Tool{
+		Name:        "start_download",
+		Description: "Start downloading audio files from an Internet Archive item in the background and return a job ID immediately",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args DownloadArgs) (*mcp.CallToolResult, any, error) {
+		if err := archive.ValidateIdentifier(args.Identifier); err != nil {
+			return errorResult("Failed to start download: %v", err), nil, nil
+		}
+
+		job, err := d.jobs.Submit(args.Identifier, args)
+		if err != nil {
+			return errorResult("Failed to start download: %v", err), nil, nil
+		}
+
+		return jsonResult(map[string]interface{}{
+			"job_id":     job.ID,
+			"identifier": job.Identifier,
+			"state":      job.State,
+		}, "job"), nil, nil
+	})
+
+	mcp.AddTool(d.server, &mcp.Tool{
+		Name:        "get_download_status",
+		Description: "Get the state and per-file progress of a background download job",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args JobArgs) (*mcp.CallToolResult, any, error) {
+		job, err := d.jobs.Get(args.JobID)
+		if err != nil {
+			return errorResult("Failed to get download status: %v", err), nil, nil
+		}
+
+		return jsonResult(newJobStatus(job), "job status"), nil, nil
+	})
+
+	mcp.AddTool(d.server, &mcp.Tool{
+		Name:        "list_downloads",
+		Description: "List background download jobs and their states",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args ListDownloadsArgs) (*mcp.CallToolResult, any, error) {
+		summaries := []map[string]interface{}{}
+		for _, job := range d.jobs.List() {
+			if args.State != "" && string(job.State) != args.State {
+				continue
+			}
+			status := newJobStatus(job)
+			summaries = append(summaries, map[string]interface{}{
+				"job_id":      job.ID,
+				"identifier":  job.Identifier,
+				"state":       job.State,
+				"files":       len(job.Files),
+				"bytes_done":  status.BytesDone,
+				"bytes_total": status.BytesTotal,
+				"error":       job.Error,
+				"updated_at":  job.UpdatedAt,
+			})
+		}
+
+		return jsonResult(summaries, "jobs"), nil, nil
+	})
+
+	mcp.AddTool(d.server, &mcp.Tool{
+		Name:        "cancel_download",
+		Description: "Cancel a queued or running background download job",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args JobArgs) (*mcp.CallToolResult, any, error) {
+		job, err := d.jobs.Cancel(args.JobID)
+		if err != nil && !errors.Is(err, jobs.ErrFinished) {
+			return errorResult("Failed to cancel download: %v", err), nil, nil
+		}
+		if err != nil {
+			return errorResult("Download job %s already %s", job.ID, job.State), nil, nil
+		}
+
+		return jsonResult(map[string]interface{}{
+			"job_id": job.ID,
+			"state":  job.State,
+		}, "job"), nil, nil
+	})
+}
+
+func newJobStatus(job jobs.Job) JobStatus {
+	status := JobStatus{Job: job}
+	for _, file := range job.Files {
+		status.BytesDone += file.Bytes
+		status.BytesTotal += file.Total
+	}
+	return status
+}
+
+func (o *jobObserver) begin(files []archive.FileInfo) {
+	progress := make([]jobs.FileProgress, 0, len(files))
+	for _, file := range files {
+		progress = append(progress, jobs.FileProgress{Name: file.Name, State: jobs.FilePending, Total: file.SizeBytes()})
+	}
+	o.update.SetFiles(progress)
+}
+
+func (o *jobObserver) file(name string) archive.ProgressFunc {
+	return func(written, total int64) {
+		o.update.SetFileProgress(name, written, total)
+	}
+}
+
+func (o *jobObserver) fileDone(name string, _ int64, skipped bool) {
+	if skipped {
+		o.update.SetFileState(name, jobs.FileSkipped, nil)
+		return
+	}
+	o.update.SetFileState(name, jobs.FileDone, nil)
+}
+
+func (o *jobObserver) fileFailed(name string, err error) {
+	o.update.SetFileState(name, jobs.FileFailed, err)
+}
+
+func (o *jobObserver) concat(string, int64) concat.ProgressFunc {
+	return nil
+}
+
+func (o *jobObserver) concatDone(string, int64) {}
@@ -2,15 +2,12 @@ package main
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -18,12 +15,33 @@ import (
 	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
 	"github.com/palanquin-software/mcp-internet-archive/pkg/concat"
 	"github.com/palanquin-software/mcp-internet-archive/pkg/config"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/jobs"
 )
 
+const startCursor = "*"
+
 type (
 	SearchArgs struct {
-		Query      string `json:"query" jsonschema:"Search query for Internet Archive audio content"`
-		MaxResults int    `json:"max_results,omitempty" jsonschema:"Maximum number of results to return (default: configured value)"`
+		Query        string `json:"query,omitempty" jsonschema:"Free-text search query for Internet Archive audio content"`
+		MaxResults   int    `json:"max_results,omitempty" jsonschema:"Maximum number of results to return (default: configured value)"`
+		Page         int    `json:"page,omitempty" jsonschema:"1-based page of results to return, using max_results per page (default: 1)"`
+		Cursor       string `json:"cursor,omitempty" jsonschema:"Cursor for walking deep result sets with the scrape API. Pass * to start, then the next_cursor from the previous call. Batches hold at least 100 results"`
+		Creator      string `json:"creator,omitempty" jsonschema:"Only items by this creator"`
+		Collection   string `json:"collection,omitempty" jsonschema:"Only items in this collection identifier, e.g. oldtimeradio"`
+		Subject      string `json:"subject,omitempty" jsonschema:"Only items tagged with this subject"`
+		Language     string `json:"language,omitempty" jsonschema:"Only items in this language, e.g. English or eng"`
+		DateFrom     string `json:"date_from,omitempty" jsonschema:"Earliest item date as YYYY, YYYY-MM or YYYY-MM-DD"`
+		DateTo       string `json:"date_to,omitempty" jsonschema:"Latest item date as YYYY, YYYY-MM or YYYY-MM-DD"`
+		MinDownloads int    `json:"min_downloads,omitempty" jsonschema:"Only items downloaded at least this many times"`
+		MaxDownloads int    `json:"max_downloads,omitempty" jsonschema:"Only items downloaded at most this many times"`
+		Sort         string `json:"sort,omitempty" jsonschema:"Comma-separated sort fields with optional asc/desc, e.g. 'downloads desc, date asc'. Fields: downloads, date, publicdate, addeddate, titleSorter, creatorSorter, avg_rating, num_reviews, week, month"`
+	}
+	SearchOutput struct {
+		NumFound   int                    `json:"numFound"`
+		Start      int                    `json:"start"`
+		Docs       []archive.SearchResult `json:"docs"`
+		NextPage   int                    `json:"next_page,omitempty"`
+		NextCursor string                 `json:"next_cursor,omitempty"`
 	}
 	MetadataArgs struct {
 		Identifier string `json:"identifier" jsonschema:"Internet Archive item identifier"`
@@ -31,12 +49,17 @@ type (
 	DownloadArgs struct {
 		Identifier string `json:"identifier" jsonschema:"Internet Archive item identifier to download audio files from"`
 		Concat     *bool  `json:"concat,omitempty" jsonschema:"Whether to concatenate multi-part files. If not specified, will prompt if parts >= threshold"`
+		AllFormats bool   `json:"all_formats,omitempty" jsonschema:"Download every matching format of each track instead of only the highest ranked one"`
+		// ConcatFormat asks for chapterized output in place of a plain join.
+		ConcatFormat string `json:"concat_format,omitempty" jsonschema:"Write each concatenated set as one m4b or mka file with a chapter per part, titled from the file metadata. Defaults to the format of the parts, without chapters"`
 	}
 	Delegate struct {
-		ctx    context.Context
-		server *mcp.Server
-		client *archive.Client
-		cfg    *config.Config
+		ctx      context.Context
+		server   *mcp.Server
+		client   *archive.Client
+		cfg      *config.Config
+		jobs     *jobs.Manager
+		detector *concat.Detector
 	}
 )
 
@@ -53,7 +76,11 @@ func main() {
 		log.Fatalf("Invalid config: %v", err)
 	}
 
-	client := archive.NewClient(cfg.APIKey())
+	options, err := cfg.ClientOptions()
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	client := archive.NewClient(cfg.APIKey(), options...)
 
 	d := &Delegate{
 		ctx:    ctx,
@@ -68,10 +95,34 @@ func main() {
 }
 
 func (d *Delegate) Start() error {
+	if err := d.Register(); err != nil {
+		return err
+	}
+	return d.server.Run(d.ctx, &mcp.StdioTransport{})
+}
+
+func (d *Delegate) Register() error {
+	// Saved jobs resume as soon as the manager starts, so everything
+	// downloadItem uses must be in place first.
+	detector, err := d.cfg.PartDetector()
+	if err != nil {
+		return err
+	}
+	d.detector = detector
+	if err := d.startJobs(); err != nil {
+		return err
+	}
 	d.addSearchTool()
 	d.addMetadataTool()
 	d.addDownloadTool()
-	return d.server.Run(d.ctx, &mcp.StdioTransport{})
+	d.addVerifyTool()
+	d.addJobTools()
+	d.addCredentialsTool()
+	d.addUpdateMetadataTool()
+	if d.cfg.EnableUpload {
+		d.addUploadTool()
+	}
+	return nil
 }
 
 func (d *Delegate) addSearchTool() {
@@ -84,238 +135,162 @@ func (d *Delegate) addSearchTool() {
 			maxResults = d.cfg.MaxResults
 		}
 
-		result, err := d.client.Search(args.Query, maxResults)
+		query, err := args.searchQuery()
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Search failed: %v", err)},
-				},
-				IsError: true,
-			}, nil, nil
+			return errorResult("Invalid search: %v", err), nil, nil
+		}
+
+		if args.Cursor != "" {
+			cursor := args.Cursor
+			if cursor == startCursor {
+				cursor = ""
+			}
+
+			result, err := d.client.ScrapeContext(ctx, query, maxResults, cursor)
+			if err != nil {
+				return errorResult("Search failed: %s", describeError(err)), nil, nil
+			}
+
+			return jsonResult(SearchOutput{
+				NumFound:   result.Total,
+				Docs:       result.Items,
+				NextCursor: result.Cursor,
+			}, "results"), nil, nil
 		}
 
-		jsonBytes, err := json.MarshalIndent(result.Response, "", "  ")
+		page := max(args.Page, 1)
+		result, err := d.client.SearchPageContext(ctx, query, maxResults, page)
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to marshal results: %v", err)},
-				},
-				IsError: true,
-			}, nil, nil
+			return errorResult("Search failed: %s", describeError(err)), nil, nil
+		}
+
+		output := SearchOutput{
+			NumFound: result.Response.NumFound,
+			Start:    result.Response.Start,
+			Docs:     result.Response.Docs,
+		}
+		if output.Start+len(output.Docs) < output.NumFound && len(output.Docs) > 0 {
+			output.NextPage = page + 1
 		}
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(jsonBytes)},
-			},
-		}, nil, nil
+		return jsonResult(output, "results"), nil, nil
 	})
 }
 
 func (d *Delegate) addMetadataTool() {
 	mcp.AddTool(d.server, &mcp.Tool{
 		Name:        "get_metadata",
-		Description: "Get detailed metadata and file information for an Internet Archive item",
+		Description: "Get metadata for an Internet Archive item with a per-file summary of formats, sizes and durations, and item totals",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args MetadataArgs) (*mcp.CallToolResult, any, error) {
-		result, err := d.client.GetMetadata(args.Identifier)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to get metadata: %v", err)},
-				},
-				IsError: true,
-			}, nil, nil
+		result, err := d.client.GetMetadataContext(ctx, args.Identifier)
+		if errors.Is(err, archive.ErrItemRestricted) {
+			restricted := jsonResult(d.summarizeMetadata(args.Identifier, result), "metadata")
+			restricted.Content = append(restricted.Content, &mcp.TextContent{Text: "Note: " + describeError(err)})
+			return restricted, nil, nil
 		}
-
-		jsonBytes, err := json.MarshalIndent(result, "", "  ")
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to marshal metadata: %v", err)},
-				},
-				IsError: true,
-			}, nil, nil
+			return errorResult("Failed to get metadata: %s", describeError(err)), nil, nil
 		}
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(jsonBytes)},
-			},
-		}, nil, nil
+		return jsonResult(d.summarizeMetadata(args.Identifier, result), "metadata"), nil, nil
 	})
 }
 
-func (d *Delegate) addDownloadTool() {
+func (d *Delegate) addCredentialsTool() {
 	mcp.AddTool(d.server, &mcp.Tool{
-		Name:        "download_audio",
-		Description: "Download audio files from an Internet Archive item according to configured format preferences",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, args DownloadArgs) (*mcp.CallToolResult, any, error) {
-		metadata, err := d.client.GetMetadata(args.Identifier)
+		Name:        "check_credentials",
+		Description: "Check that the configured Internet Archive S3 keys are valid. Logged-in-only files need them",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+		result, err := d.client.CheckCredentials(ctx)
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to get metadata: %v", err)},
-				},
-				IsError: true,
-			}, nil, nil
-		}
-
-		destDir := filepath.Join(d.cfg.DownloadDirectory, args.Identifier)
-		if err := os.MkdirAll(destDir, 0755); err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to create directory: %v", err)},
-				},
-				IsError: true,
-			}, nil, nil
+			return errorResult("Credentials check failed: %s", describeError(err)), nil, nil
 		}
-
-		var downloadedFiles []string
-		var skippedFiles []string
-
-		for _, format := range d.cfg.AudioFormatPreference {
-			for _, file := range metadata.Files {
-				if !matchesFormat(file.Format, format) {
-					continue
-				}
-
-				destPath := filepath.Join(destDir, file.Name)
-
-				if file.MD5 != "" {
-					exists, err := fileExistsWithMD5(destPath, file.MD5)
-					if err != nil {
-						return &mcp.CallToolResult{
-							Content: []mcp.Content{
-								&mcp.TextContent{Text: fmt.Sprintf("Failed to check file: %v", err)},
-							},
-							IsError: true,
-						}, nil, nil
-					}
-					if exists {
-						skippedFiles = append(skippedFiles, file.Name)
-						continue
-					}
-				}
-
-				if err := d.client.DownloadFile(args.Identifier, file.Name, destPath); err != nil {
-					return &mcp.CallToolResult{
-						Content: []mcp.Content{
-							&mcp.TextContent{Text: fmt.Sprintf("Failed to download %s: %v", file.Name, err)},
-						},
-						IsError: true,
-					}, nil, nil
-				}
-
-				downloadedFiles = append(downloadedFiles, file.Name)
-			}
+		if !result.Authorized {
+			return errorResult("archive.org rejected the configured keys. %s", errorHint(archive.ErrUnauthorized)), nil, nil
 		}
 
-		multiPartSets := concat.DetectMultiPartSets(downloadedFiles)
-
-		response := map[string]interface{}{
-			"identifier":       args.Identifier,
-			"download_dir":     destDir,
-			"downloaded_files": downloadedFiles,
-			"skipped_files":    skippedFiles,
-		}
+		return jsonResult(result, "credentials"), nil, nil
+	})
+}
 
-		if len(multiPartSets) > 0 {
-			shouldConcat := false
-			if args.Concat != nil {
-				shouldConcat = *args.Concat
-			} else {
-				for _, set := range multiPartSets {
-					if len(set.Files) >= d.cfg.ConcatAskThreshold {
-						response["multi_part_detected"] = true
-						response["multi_part_sets"] = multiPartSets
-						response["suggestion"] = fmt.Sprintf("Found %d multi-part file sets. Re-run with concat=true to concatenate them using ffmpeg.", len(multiPartSets))
-						break
-					}
-				}
-			}
+func (a SearchArgs) searchQuery() (archive.SearchQuery, error) {
+	query := archive.SearchQuery{
+		Text:         a.Query,
+		Creator:      a.Creator,
+		Collection:   a.Collection,
+		Subject:      a.Subject,
+		Language:     a.Language,
+		DateFrom:     a.DateFrom,
+		DateTo:       a.DateTo,
+		MinDownloads: a.MinDownloads,
+		MaxDownloads: a.MaxDownloads,
+	}
 
-			if shouldConcat {
-				if err := concat.CheckFFMPEG(d.cfg.FFMPEG); err != nil {
-					response["concat_error"] = fmt.Sprintf("ffmpeg not available: %v", err)
-				} else {
-					var concatenatedFiles []string
-					for _, set := range multiPartSets {
-						outputPath := filepath.Join(destDir, set.OutputName)
-
-						var fullPaths []string
-						for _, file := range set.Files {
-							fullPaths = append(fullPaths, filepath.Join(destDir, file))
-						}
-
-						if err := concat.ConcatenateFiles(d.cfg.FFMPEG, fullPaths, outputPath); err != nil {
-							response["concat_error"] = fmt.Sprintf("Failed to concatenate %s: %v", set.OutputName, err)
-							break
-						}
-
-						concatenatedFiles = append(concatenatedFiles, set.OutputName)
-
-						for _, file := range fullPaths {
-							_ = os.Remove(file)
-						}
-					}
-
-					if len(concatenatedFiles) > 0 {
-						response["concatenated_files"] = concatenatedFiles
-						response["downloaded_files"] = concatenatedFiles
-					}
-				}
-			}
+	for _, field := range strings.Split(a.Sort, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
 		}
-
-		jsonBytes, err := json.MarshalIndent(response, "", "  ")
+		sort, err := archive.ParseSortField(field)
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to marshal response: %v", err)},
-				},
-				IsError: true,
-			}, nil, nil
+			return archive.SearchQuery{}, err
 		}
+		query.Sort = append(query.Sort, sort)
+	}
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(jsonBytes)},
-			},
-		}, nil, nil
-	})
+	if err := query.Validate(); err != nil {
+		return archive.SearchQuery{}, err
+	}
+	return query, nil
 }
 
-func matchesFormat(fileFormat string, audioFormat archive.AudioFormat) bool {
-	lowerFormat := strings.ToLower(fileFormat)
-	switch audioFormat {
-	case archive.FLAC:
-		return strings.Contains(lowerFormat, "flac")
-	case archive.Wave:
-		return strings.Contains(lowerFormat, "wave") || strings.Contains(lowerFormat, "wav")
-	case archive.MP3:
-		return strings.Contains(lowerFormat, "mp3")
-	case archive.OGG:
-		return strings.Contains(lowerFormat, "ogg") || strings.Contains(lowerFormat, "vorbis")
+// errorHint suggests what the caller can do about archive.org failures that
+// survived the client's retries.
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, archive.ErrItemDark):
+		return "Dark items cannot be viewed or downloaded; look for another copy with search_audio"
+	case errors.Is(err, archive.ErrItemRestricted):
+		return "Its files are only available through archive.org lending and cannot be downloaded"
+	case errors.Is(err, archive.ErrNoCredentials), errors.Is(err, archive.ErrUnauthorized):
+		return "Set IA_S3_ACCESS_KEY and IA_S3_SECRET_KEY to keys from https://archive.org/account/s3.php, then run check_credentials to confirm they work"
+	case errors.Is(err, archive.ErrMetadataWriteRejected):
+		return "Check that the fields exist and that the configured account owns the item"
+	case errors.Is(err, archive.ErrNotFound):
+		return "Check the identifier and file name; search_audio lists valid identifiers"
+	case errors.Is(err, archive.ErrRateLimited):
+		return "archive.org is throttling requests; wait a minute before retrying or lower IA_RATE_LIMIT"
+	case errors.Is(err, archive.ErrUnavailable):
+		return "archive.org appears to be down or overloaded; try again later"
 	default:
-		return false
+		return ""
 	}
 }
 
-func fileExistsWithMD5(path string, expectedMD5 string) (bool, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, err
+func describeError(err error) string {
+	if hint := errorHint(err); hint != "" {
+		return fmt.Sprintf("%v. %s", err, hint)
 	}
-	defer func(f *os.File) { _ = f.Close() }(f)
+	return err.Error()
+}
+
+func errorResult(format string, args ...any) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf(format, args...)},
+		},
+		IsError: true,
+	}
+}
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, f); err != nil {
-		return false, err
+func jsonResult(v any, what string) *mcp.CallToolResult {
+	jsonBytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errorResult("Failed to marshal %s: %v", what, err)
 	}
 
-	actualMD5 := hex.EncodeToString(hash.Sum(nil))
-	return actualMD5 == expectedMD5, nil
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: string(jsonBytes)},
+		},
+	}
 }
@@ -0,0 +1,904 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive/archivetest"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/concat"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/config"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/jobs"
+)
+
+type testEnv struct {
+	t        *testing.T
+	ctx      context.Context
+	cancel   context.CancelFunc
+	fake     *archivetest.Server
+	cfg      *config.Config
+	delegate *Delegate
+	session  *mcp.ClientSession
+
+	mu       sync.Mutex
+	progress []*mcp.ProgressNotificationParams
+}
+
+func newTestEnv(t *testing.T, items ...archivetest.Item) *testEnv {
+	t.Helper()
+	return newConfiguredTestEnv(t, nil, items...)
+}
+
+// newConfiguredTestEnv lets configure adjust the config before the tools are
+// registered.
+func newConfiguredTestEnv(t *testing.T, configure func(*config.Config), items ...archivetest.Item) *testEnv {
+	t.Helper()
+
+	fake := archivetest.NewServer(items...)
+	cfg := &config.Config{
+		AudioFormatPreference: []archive.AudioFormat{archive.FLAC, archive.Wave, archive.MP3, archive.OGG},
+		MaxResults:            10,
+		DownloadDirectory:     t.TempDir(),
+		FFMPEG:                filepath.Join(t.TempDir(), "ffmpeg-missing"),
+		ConcatAskThreshold:    3,
+		DownloadConcurrency:   2,
+		JobConcurrency:        1,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	env := &testEnv{t: t, ctx: ctx, cancel: cancel, fake: fake, cfg: cfg}
+	env.delegate = &Delegate{
+		ctx:    ctx,
+		server: mcp.NewServer(&mcp.Implementation{Name: "mcp-internet-archive", Version: "test"}, nil),
+		client: archive.NewClient(cfg.APIKey(), append(fake.ClientOptions(), archive.WithUploadPartSize(cfg.UploadPartSize))...),
+		cfg:    cfg,
+	}
+	if err := env.delegate.Register(); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := env.delegate.server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server Connect failed: %v", err)
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			env.mu.Lock()
+			defer env.mu.Unlock()
+			env.progress = append(env.progress, req.Params)
+		},
+	})
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client Connect failed: %v", err)
+	}
+	env.session = session
+
+	t.Cleanup(func() {
+		_ = session.Close()
+		cancel()
+		env.delegate.jobs.Wait()
+		fake.Close()
+	})
+	return env
+}
+
+func (e *testEnv) call(name string, args any) (*mcp.CallToolResult, string) {
+	e.t.Helper()
+	return e.callWithMeta(name, args, nil)
+}
+
+func (e *testEnv) callWithMeta(name string, args any, meta mcp.Meta) (*mcp.CallToolResult, string) {
+	e.t.Helper()
+
+	result, err := e.session.CallTool(e.ctx, &mcp.CallToolParams{Name: name, Arguments: args, Meta: meta})
+	if err != nil {
+		e.t.Fatalf("CallTool(%s) failed: %v", name, err)
+	}
+	if len(result.Content) == 0 {
+		e.t.Fatalf("CallTool(%s) returned no content", name)
+	}
+	text, ok := result.Content[0].(*mcp.TextContent)
+	if !ok {
+		e.t.Fatalf("CallTool(%s) returned %T, want text", name, result.Content[0])
+	}
+	return result, text.Text
+}
+
+func (e *testEnv) callJSON(name string, args any, out any) {
+	e.t.Helper()
+
+	result, text := e.call(name, args)
+	if result.IsError {
+		e.t.Fatalf("CallTool(%s) returned error: %s", name, text)
+	}
+	if err := json.Unmarshal([]byte(text), out); err != nil {
+		e.t.Fatalf("CallTool(%s) returned invalid JSON: %v\n%s", name, err, text)
+	}
+}
+
+func (e *testEnv) progressNotifications() []*mcp.ProgressNotificationParams {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*mcp.ProgressNotificationParams(nil), e.progress...)
+}
+
+func TestSearchAudio(t *testing.T) {
+	env := newTestEnv(t,
+		archivetest.AudioItem("item-a", "Alpha"),
+		archivetest.AudioItem("item-b", "Bravo"),
+		archivetest.AudioItem("item-c", "Charlie"),
+	)
+
+	var page SearchOutput
+	env.callJSON("search_audio", SearchArgs{Query: "radio: (1944)", MaxResults: 2}, &page)
+	if page.NumFound != 3 || len(page.Docs) != 2 || page.NextPage != 2 {
+		t.Errorf("Unexpected first page: %+v", page)
+	}
+
+	var second SearchOutput
+	env.callJSON("search_audio", SearchArgs{Query: "radio", MaxResults: 2, Page: 2}, &second)
+	if len(second.Docs) != 1 || second.Docs[0].Identifier != "item-c" || second.NextPage != 0 {
+		t.Errorf("Unexpected second page: %+v", second)
+	}
+
+	var scraped SearchOutput
+	env.callJSON("search_audio", SearchArgs{Creator: "Archivetest Players", Cursor: "*"}, &scraped)
+	if scraped.NumFound != 3 || len(scraped.Docs) != 3 || scraped.NextCursor != "" {
+		t.Errorf("Unexpected scrape results: %+v", scraped)
+	}
+
+	if result, text := env.call("search_audio", SearchArgs{}); !result.IsError {
+		t.Errorf("Expected error for empty search, got %s", text)
+	}
+	if result, text := env.call("search_audio", SearchArgs{Query: "jazz", Sort: "random"}); !result.IsError {
+		t.Errorf("Expected error for invalid sort, got %s", text)
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	item := archivetest.MultiPartItem("broadcast-day", "Broadcast", 3, 64)
+	item.Files[0].Info.Length = "1:02:03"
+	item.Files[1].Info.Length = "205.5"
+	item.Files[2].Info.Length = "10:00"
+	item.Files = append(item.Files, archivetest.File{
+		Info:    archive.FileInfo{Name: "Broadcast_Part_1.ogg", Format: "Ogg Vorbis", Source: "derivative", Original: "Broadcast_Part_1.mp3", Length: "3723.1"},
+		Content: make([]byte, 2048),
+	})
+	env := newTestEnv(t, item)
+
+	var metadata MetadataOutput
+	env.callJSON("get_metadata", MetadataArgs{Identifier: "broadcast-day"}, &metadata)
+	if metadata.Metadata.Identifier != "broadcast-day" || len(metadata.Files) != 4 {
+		t.Fatalf("Unexpected metadata: %+v", metadata)
+	}
+
+	first := metadata.Files[0]
+	if first.SizeBytes != 64 || first.Size != "64 B" || first.Duration != "1:02:03" || first.DurationSeconds != 3723 || first.AudioFormat != archive.MP3 {
+		t.Errorf("Unexpected file summary: %+v", first)
+	}
+	if ogg := metadata.Files[3]; ogg.Size != "2.0 KiB" || ogg.Original != "Broadcast_Part_1.mp3" || ogg.AudioFormat != archive.OGG {
+		t.Errorf("Unexpected derivative summary: %+v", ogg)
+	}
+
+	totals := metadata.Totals
+	if totals.Files != 4 || totals.AudioFiles != 4 || totals.Tracks != 3 || totals.SizeBytes != 64*3+2048 {
+		t.Errorf("Unexpected totals: %+v", totals)
+	}
+	if totals.Duration != "1:15:29" {
+		t.Errorf("Expected the derivative to be left out of the running time, got %s", totals.Duration)
+	}
+
+	if result, text := env.call("get_metadata", MetadataArgs{Identifier: "../../etc"}); !result.IsError {
+		t.Errorf("Expected error for invalid identifier, got %s", text)
+	}
+}
+
+func TestUnavailableItems(t *testing.T) {
+	dark := archivetest.AudioItem("dark-item", "Dark")
+	dark.Dark = true
+	restricted := archivetest.AudioItem("lent-item", "Lent", archivetest.AudioFile("lent.mp3", "VBR MP3", 128))
+	restricted.Metadata.AccessRestrictedItem = "true"
+	env := newTestEnv(t, dark, restricted)
+
+	tests := []struct {
+		identifier string
+		want       string
+	}{
+		{"no-such-item", "not found"},
+		{"dark-item", "dark"},
+		{"lent-item", "access-restricted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.identifier, func(t *testing.T) {
+			result, text := env.call("download_audio", DownloadArgs{Identifier: tt.identifier})
+			if !result.IsError || !strings.Contains(text, tt.want) {
+				t.Errorf("Expected download error mentioning %q, got %s", tt.want, text)
+			}
+		})
+	}
+
+	if result, text := env.call("get_metadata", MetadataArgs{Identifier: "dark-item"}); !result.IsError || !strings.Contains(text, "dark") {
+		t.Errorf("Expected get_metadata error for dark item, got %s", text)
+	}
+
+	result, _ := env.call("get_metadata", MetadataArgs{Identifier: "lent-item"})
+	if result.IsError || len(result.Content) != 2 {
+		t.Fatalf("Expected restricted metadata with a note, got %+v", result)
+	}
+	if note := result.Content[1].(*mcp.TextContent).Text; !strings.Contains(note, "lending") {
+		t.Errorf("Expected lending note, got %q", note)
+	}
+	if _, err := os.Stat(filepath.Join(env.cfg.DownloadDirectory, "lent-item")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written for a restricted item, stat returned: %v", err)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	item := archivetest.AudioItem("members-item", "Members",
+		archivetest.AudioFile("public.mp3", "VBR MP3", 128),
+		archivetest.AudioFile("members.mp3", "VBR MP3", 128),
+	)
+	item.Files[1].Info.Private = "true"
+	env := newTestEnv(t, item)
+	env.fake.SetCredentials("access", "secret")
+
+	if result, text := env.call("check_credentials", struct{}{}); !result.IsError || !strings.Contains(text, "IA_S3_ACCESS_KEY") {
+		t.Errorf("Expected missing credentials error, got %s", text)
+	}
+
+	var anonymous map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "members-item"}, &anonymous)
+	if required := stringList(anonymous["auth_required_files"]); len(required) != 1 || required[0] != "members.mp3" {
+		t.Errorf("Expected members.mp3 to require auth, got %v", anonymous["auth_required_files"])
+	}
+	if failed, _ := anonymous["failed_files"].([]any); len(failed) != 1 || !strings.Contains(failed[0].(map[string]any)["error"].(string), "check_credentials") {
+		t.Errorf("Expected members.mp3 to fail with a credentials hint, got %v", anonymous["failed_files"])
+	}
+
+	env.delegate.client = archive.NewClient("access:wrong", env.fake.ClientOptions()...)
+	if result, text := env.call("check_credentials", struct{}{}); !result.IsError || !strings.Contains(text, "rejected") {
+		t.Errorf("Expected rejected credentials, got %s", text)
+	}
+
+	env.delegate.client = archive.NewClient("access:secret", env.fake.ClientOptions()...)
+	var status archive.CredentialsResponse
+	env.callJSON("check_credentials", struct{}{}, &status)
+	if !status.Authorized || status.AccessKey != "access" {
+		t.Errorf("Unexpected credentials status: %+v", status)
+	}
+
+	var authenticated map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "members-item"}, &authenticated)
+	if downloaded := stringList(authenticated["downloaded_files"]); len(downloaded) != 1 || downloaded[0] != "members.mp3" {
+		t.Errorf("Expected members.mp3 to download with credentials, got %v", authenticated)
+	}
+}
+
+func TestDownloadAudio(t *testing.T) {
+	item := archivetest.MultiPartItem("broadcast-day", "Broadcast", 4, 2048)
+	item.Files = append(item.Files,
+		archivetest.File{Info: archive.FileInfo{Name: "Broadcast_Part_1.ogg", Format: "Ogg Vorbis", Source: "derivative", Original: "Broadcast_Part_1.mp3"}, Content: []byte("ogg")},
+		archivetest.File{Info: archive.FileInfo{Name: "cover.jpg", Format: "JPEG"}, Content: []byte("jpeg")},
+	)
+	env := newTestEnv(t, item)
+
+	var response map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "broadcast-day"}, &response)
+
+	downloaded := stringList(response["downloaded_files"])
+	if len(downloaded) != 4 {
+		t.Fatalf("Expected 4 downloaded files, got %v", downloaded)
+	}
+	for _, file := range item.Files[:4] {
+		data, err := os.ReadFile(filepath.Join(env.cfg.DownloadDirectory, "broadcast-day", file.Info.Name))
+		if err != nil {
+			t.Fatalf("Expected %s on disk: %v", file.Info.Name, err)
+		}
+		if string(data) != string(file.Content) {
+			t.Errorf("Content mismatch for %s", file.Info.Name)
+		}
+	}
+	if response["multi_part_detected"] != true {
+		t.Errorf("Expected multi-part suggestion, got %v", response)
+	}
+
+	var rerun map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "broadcast-day"}, &rerun)
+	if skipped := stringList(rerun["skipped_files"]); len(skipped) != 4 {
+		t.Errorf("Expected 4 skipped files on second run, got %v", skipped)
+	}
+
+	var allFormats map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "broadcast-day", AllFormats: true}, &allFormats)
+	if downloaded := stringList(allFormats["downloaded_files"]); len(downloaded) != 1 || downloaded[0] != "Broadcast_Part_1.ogg" {
+		t.Errorf("Expected only the Ogg derivative to be newly downloaded, got %v", downloaded)
+	}
+
+	concatenate := true
+	var concatenated map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "broadcast-day", Concat: &concatenate}, &concatenated)
+	if _, ok := concatenated["concat_error"]; !ok {
+		t.Errorf("Expected concat_error without ffmpeg, got %v", concatenated)
+	}
+}
+
+func TestDownloadAudioWithoutChecksums(t *testing.T) {
+	file := archivetest.AudioFile("Interview.mp3", "VBR MP3", 1024)
+	file.NoChecksums = true
+	env := newTestEnv(t, archivetest.AudioItem("interview", "Interview", file))
+
+	var response map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "interview"}, &response)
+	if downloaded := stringList(response["downloaded_files"]); len(downloaded) != 1 {
+		t.Fatalf("Expected 1 downloaded file, got %v", response)
+	}
+
+	env.callJSON("download_audio", DownloadArgs{Identifier: "interview"}, &response)
+	if skipped := stringList(response["skipped_files"]); len(skipped) != 1 {
+		t.Errorf("Expected a copy of the right size to be skipped, got %v", response)
+	}
+
+	path := filepath.Join(env.cfg.DownloadDirectory, "interview", "Interview.mp3")
+	if err := os.Truncate(path, 512); err != nil {
+		t.Fatalf("Failed to truncate %s: %v", path, err)
+	}
+	var verified VerifyItemOutput
+	env.callJSON("verify_item", VerifyItemArgs{Identifier: "interview"}, &verified)
+	if verified.Mismatched != 1 || verified.Unverifiable != 0 {
+		t.Errorf("Expected the truncated file to be reported as a mismatch, got %+v", verified)
+	}
+	env.callJSON("download_audio", DownloadArgs{Identifier: "interview"}, &response)
+	if downloaded := stringList(response["downloaded_files"]); len(downloaded) != 1 {
+		t.Errorf("Expected a copy of the wrong size to be downloaded again, got %v", response)
+	}
+}
+
+func TestDownloadAudioPartOrder(t *testing.T) {
+	item := archivetest.MultiPartItem("long-broadcast", "Broadcast", 12, 16)
+	env := newTestEnv(t, item)
+
+	var response struct {
+		MultiPartSets []concat.MultiPartSet `json:"multi_part_sets"`
+	}
+	env.callJSON("download_audio", DownloadArgs{Identifier: "long-broadcast"}, &response)
+	if len(response.MultiPartSets) != 1 {
+		t.Fatalf("Expected 1 multi-part set, got %+v", response.MultiPartSets)
+	}
+
+	set := response.MultiPartSets[0]
+	if len(set.Files) != 12 || set.OrderedBy != concat.OrderByPartNumber {
+		t.Fatalf("Unexpected set: %+v", set)
+	}
+	for i, file := range set.Files {
+		if expected := fmt.Sprintf("Broadcast_Part_%d.mp3", i+1); file != expected {
+			t.Errorf("Expected %s at position %d, got %s", expected, i, file)
+		}
+	}
+}
+
+// fakeFFMPEG writes a shell script standing in for ffmpeg. It keeps a copy
+// of any FFMETADATA file it is given next to itself and creates the output.
+func fakeFFMPEG(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	body := `#!/bin/sh
+for arg; do
+	case "$arg" in *.ffmetadata.txt) cp "$arg" "$0.ffmetadata" ;; esac
+	last=$arg
+done
+[ "$last" = -version ] || : > "$last"
+`
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatalf("Failed to write fake ffmpeg: %v", err)
+	}
+	return script
+}
+
+func TestDownloadAudioChapters(t *testing.T) {
+	item := archivetest.MultiPartItem("serial", "Serial", 3, 64)
+	for i := range item.Files {
+		item.Files[i].Info.Length = fmt.Sprintf("%d", 60*(i+1))
+	}
+	item.Files[0].Info.Title = "Episode One"
+	item.Files[2].Info.Title = "Episode Three"
+	ffmpeg := fakeFFMPEG(t)
+	env := newConfiguredTestEnv(t, func(cfg *config.Config) { cfg.FFMPEG = ffmpeg }, item)
+
+	_, text := env.call("download_audio", DownloadArgs{Identifier: "serial", ConcatFormat: "aiff"})
+	if !strings.Contains(text, "concat_format") {
+		t.Errorf("Expected an unsupported concat_format to be refused, got %s", text)
+	}
+
+	concatenate := true
+	var response struct {
+		ConcatenatedFiles []string       `json:"concatenated_files"`
+		ConcatPlans       []ConcatReport `json:"concat_plans"`
+		ConcatError       string         `json:"concat_error"`
+	}
+	env.callJSON("download_audio", DownloadArgs{Identifier: "serial", Concat: &concatenate, ConcatFormat: concat.FormatM4B}, &response)
+	if response.ConcatError != "" || len(response.ConcatenatedFiles) != 1 || response.ConcatenatedFiles[0] != "Serial.m4b" {
+		t.Fatalf("Expected Serial.m4b, got %+v", response)
+	}
+	if _, err := os.Stat(filepath.Join(env.cfg.DownloadDirectory, "serial", "Serial.m4b")); err != nil {
+		t.Errorf("Expected the chapterized file on disk: %v", err)
+	}
+
+	report := response.ConcatPlans[0]
+	if report.Backend != concat.BackendFFMPEG || len(report.Chapters) != 3 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if chapter := report.Chapters[1]; chapter.Title != "Serial_Part_2" || chapter.StartSeconds != 60 || chapter.Start != "1:00" {
+		t.Errorf("Unexpected second chapter %+v", chapter)
+	}
+
+	metadata, err := os.ReadFile(ffmpeg + ".ffmetadata")
+	if err != nil {
+		t.Fatalf("Expected ffmpeg to be given chapter metadata: %v", err)
+	}
+	for _, line := range []string{"title=Episode One", "START=180000", "END=360000", "title=Episode Three"} {
+		if !strings.Contains(string(metadata), line+"\n") {
+			t.Errorf("Expected %q in the chapter metadata:\n%s", line, metadata)
+		}
+	}
+}
+
+func TestVerifyItem(t *testing.T) {
+	item := archivetest.MultiPartItem("broadcast-day", "Broadcast", 3, 512)
+	item.Files[0].Corrupt = 1
+	item.Files = append(item.Files, archivetest.File{Info: archive.FileInfo{Name: "notes.txt", Format: "Text"}, Content: []byte("notes")})
+	env := newTestEnv(t, item)
+
+	var response map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "broadcast-day"}, &response)
+	if downloaded := stringList(response["downloaded_files"]); len(downloaded) != 3 {
+		t.Fatalf("Expected the corrupted transfer to be retried, got %v", response)
+	}
+
+	dir := filepath.Join(env.cfg.DownloadDirectory, "broadcast-day")
+	if err := os.WriteFile(filepath.Join(dir, item.Files[1].Info.Name), make([]byte, 512), 0644); err != nil {
+		t.Fatalf("Failed to damage file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, item.Files[2].Info.Name)); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatalf("Failed to write notes: %v", err)
+	}
+
+	var verification VerifyItemOutput
+	env.callJSON("verify_item", VerifyItemArgs{Identifier: "broadcast-day"}, &verification)
+	if verification.Verified != 2 || verification.Mismatched != 1 || len(verification.Files) != 3 {
+		t.Errorf("Unexpected verification: %+v", verification)
+	}
+	for _, file := range verification.Files {
+		if file.Name == item.Files[1].Info.Name && (file.Status != verifyMismatch || len(file.Checked) != 3) {
+			t.Errorf("Expected %s to mismatch on md5, sha1 and crc32, got %+v", file.Name, file)
+		}
+	}
+	if len(verification.Missing) != 1 || verification.Missing[0] != item.Files[2].Info.Name {
+		t.Errorf("Expected %s to be missing, got %v", item.Files[2].Info.Name, verification.Missing)
+	}
+
+	var rerun map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "broadcast-day"}, &rerun)
+	if downloaded := stringList(rerun["downloaded_files"]); len(downloaded) != 2 {
+		t.Errorf("Expected the damaged and missing files to be downloaded again, got %v", rerun)
+	}
+
+	result, text := env.call("verify_item", VerifyItemArgs{Identifier: "never-downloaded"})
+	if !result.IsError || !strings.Contains(text, "nothing has been downloaded") {
+		t.Errorf("Expected an error for an item that was never downloaded, got %s", text)
+	}
+}
+
+func TestDownloadAudioPartialFailure(t *testing.T) {
+	item := archivetest.MultiPartItem("flaky-item", "Flaky", 3, 512)
+	item.Files[1].Status = 503
+	env := newTestEnv(t, item)
+
+	var response map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "flaky-item"}, &response)
+
+	if response["partial"] != true {
+		t.Errorf("Expected partial success, got %v", response)
+	}
+	failed, _ := response["failed_files"].([]any)
+	if len(failed) != 1 || !strings.Contains(failed[0].(map[string]any)["name"].(string), "Part_2") {
+		t.Errorf("Expected Part_2 to fail, got %v", response["failed_files"])
+	} else if message := failed[0].(map[string]any)["error"].(string); !strings.Contains(message, "try again later") {
+		t.Errorf("Expected an actionable error for the 503, got %q", message)
+	}
+	if downloaded := stringList(response["downloaded_files"]); len(downloaded) != 2 {
+		t.Errorf("Expected 2 downloaded files, got %v", downloaded)
+	}
+}
+
+func TestDownloadAudioRejectsUnsafePaths(t *testing.T) {
+	item := archivetest.AudioItem("nested-item", "Nested",
+		archivetest.AudioFile("disc1/track01.mp3", "VBR MP3", 128),
+		archivetest.AudioFile("../escape.mp3", "VBR MP3", 128),
+	)
+	env := newTestEnv(t, item)
+
+	if result, text := env.call("download_audio", DownloadArgs{Identifier: "../../etc"}); !result.IsError {
+		t.Errorf("Expected error for traversal identifier, got %s", text)
+	}
+
+	var response map[string]any
+	env.callJSON("download_audio", DownloadArgs{Identifier: "nested-item"}, &response)
+
+	if downloaded := stringList(response["downloaded_files"]); len(downloaded) != 1 || downloaded[0] != "disc1/track01.mp3" {
+		t.Errorf("Expected nested file to download, got %v", downloaded)
+	}
+	if _, err := os.Stat(filepath.Join(env.cfg.DownloadDirectory, "nested-item", "disc1", "track01.mp3")); err != nil {
+		t.Errorf("Expected nested file on disk: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(env.cfg.DownloadDirectory, "escape.mp3")); !os.IsNotExist(err) {
+		t.Errorf("Expected escaping file to be refused, stat returned: %v", err)
+	}
+	if failed, _ := response["failed_files"].([]any); len(failed) != 1 {
+		t.Errorf("Expected escaping file in failed_files, got %v", response["failed_files"])
+	}
+}
+
+func TestDownloadAudioProgress(t *testing.T) {
+	env := newTestEnv(t, archivetest.MultiPartItem("progress-item", "Progress", 2, 4096))
+
+	result, text := env.callWithMeta("download_audio", DownloadArgs{Identifier: "progress-item"}, mcp.Meta{"progressToken": "dl-1"})
+	if result.IsError {
+		t.Fatalf("download_audio failed: %s", text)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		notifications := env.progressNotifications()
+		if len(notifications) > 0 {
+			last := notifications[len(notifications)-1]
+			if last.Total == 8192 && last.Progress == 8192 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected progress to reach 8192/8192, got %d notifications", len(notifications))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var previous float64
+	for _, notification := range env.progressNotifications() {
+		if notification.ProgressToken != "dl-1" {
+			t.Errorf("Unexpected progress token %v", notification.ProgressToken)
+		}
+		if notification.Progress < previous {
+			t.Errorf("Progress went backwards: %v after %v", notification.Progress, previous)
+		}
+		previous = notification.Progress
+	}
+}
+
+// slowItem serves its parts slowly enough for a download to be stopped
+// part way through.
+func slowItem(identifier string) archivetest.Item {
+	item := archivetest.MultiPartItem(identifier, "Slow", 2, 1<<20)
+	for i := range item.Files {
+		item.Files[i].Delay = 20 * time.Millisecond
+		item.Files[i].ChunkSize = 1024
+	}
+	return item
+}
+
+// partialFiles waits until the .part files under dir reach want in number,
+// or the wait times out, and returns them.
+func partialFiles(t *testing.T, dir string, want int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		partial, _ := filepath.Glob(filepath.Join(dir, "*.part"))
+		if (want == 0) == (len(partial) == 0) || time.Now().After(deadline) {
+			return partial
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestDownloadAudioCancelled(t *testing.T) {
+	env := newTestEnv(t, slowItem("slow-item"))
+	dir := filepath.Join(env.cfg.DownloadDirectory, "slow-item")
+
+	ctx, cancel := context.WithCancel(env.ctx)
+	done := make(chan error, 1)
+	go func() {
+		_, err := env.session.CallTool(ctx, &mcp.CallToolParams{Name: "download_audio", Arguments: DownloadArgs{Identifier: "slow-item"}})
+		done <- err
+	}()
+	if partial := partialFiles(t, dir, 1); len(partial) == 0 {
+		t.Fatal("Download did not start")
+	}
+	cancel()
+	if err := <-done; err == nil {
+		t.Error("Expected the cancelled call to fail")
+	}
+
+	if partial := partialFiles(t, dir, 0); len(partial) != 0 {
+		t.Errorf("Expected a cancelled download to discard its partial files, got %v", partial)
+	}
+}
+
+func TestDownloadJobsKeepPartialFilesOnShutdown(t *testing.T) {
+	env := newTestEnv(t, slowItem("slow-item"))
+	dir := filepath.Join(env.cfg.DownloadDirectory, "slow-item")
+
+	var started map[string]any
+	env.callJSON("start_download", DownloadArgs{Identifier: "slow-item"}, &started)
+	if partial := partialFiles(t, dir, 1); len(partial) == 0 {
+		t.Fatal("Download did not start")
+	}
+
+	env.cancel()
+	env.delegate.jobs.Wait()
+	if partial, _ := filepath.Glob(filepath.Join(dir, "*.part")); len(partial) == 0 {
+		t.Error("Expected partial files to be kept for the resumed job")
+	}
+}
+
+func TestDownloadJobs(t *testing.T) {
+	env := newTestEnv(t, archivetest.MultiPartItem("quick-item", "Quick", 2, 256), slowItem("slow-item"))
+
+	var started map[string]any
+	env.callJSON("start_download", DownloadArgs{Identifier: "quick-item"}, &started)
+	jobID, _ := started["job_id"].(string)
+	if jobID == "" {
+		t.Fatalf("Expected job_id, got %v", started)
+	}
+
+	if status := env.waitForJob(jobID); status.State != "done" || len(status.Files) != 2 || status.BytesDone != 512 {
+		t.Errorf("Unexpected finished job: %+v", status)
+	}
+
+	env.callJSON("start_download", DownloadArgs{Identifier: "slow-item"}, &started)
+	slowID, _ := started["job_id"].(string)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var status JobStatus
+		env.callJSON("get_download_status", JobArgs{JobID: slowID}, &status)
+		if status.BytesDone > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job made no progress, last state %s", status.State)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	var cancelled map[string]any
+	env.callJSON("cancel_download", JobArgs{JobID: slowID}, &cancelled)
+	if cancelled["state"] != "cancelled" {
+		t.Errorf("Expected cancelled state, got %v", cancelled)
+	}
+	env.delegate.jobs.Wait()
+	if partial, _ := filepath.Glob(filepath.Join(env.cfg.DownloadDirectory, "slow-item", "*.part")); len(partial) != 0 {
+		t.Errorf("Expected a cancelled job to discard its partial files, got %v", partial)
+	}
+
+	var listed []map[string]any
+	env.callJSON("list_downloads", ListDownloadsArgs{}, &listed)
+	if len(listed) != 2 {
+		t.Errorf("Expected 2 jobs, got %v", listed)
+	}
+	env.callJSON("list_downloads", ListDownloadsArgs{State: "cancelled"}, &listed)
+	if len(listed) != 1 || listed[0]["job_id"] != slowID {
+		t.Errorf("Expected only the cancelled job, got %v", listed)
+	}
+
+	if result, text := env.call("get_download_status", JobArgs{JobID: "missing"}); !result.IsError {
+		t.Errorf("Expected error for unknown job, got %s", text)
+	}
+	if result, text := env.call("cancel_download", JobArgs{JobID: jobID}); !result.IsError {
+		t.Errorf("Expected error cancelling a finished job, got %s", text)
+	}
+}
+
+func TestDownloadJobsResume(t *testing.T) {
+	params, _ := json.Marshal(DownloadArgs{Identifier: "saved-item"})
+	env := newConfiguredTestEnv(t, func(cfg *config.Config) {
+		state, _ := json.Marshal(map[string]any{"jobs": []*jobs.Job{{
+			ID:         "saved-job",
+			Identifier: "saved-item",
+			State:      jobs.Running,
+			Params:     params,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		}}})
+		if err := os.WriteFile(filepath.Join(cfg.DownloadDirectory, jobStateFile), state, 0644); err != nil {
+			t.Fatalf("Failed to write job state: %v", err)
+		}
+	}, archivetest.MultiPartItem("saved-item", "Saved", 2, 256))
+
+	if status := env.waitForJob("saved-job"); status.State != "done" || len(status.Files) != 2 {
+		t.Errorf("Expected the saved job to finish, got %+v", status)
+	}
+}
+
+// waitForJob polls get_download_status until the job finishes.
+func (env *testEnv) waitForJob(jobID string) JobStatus {
+	env.t.Helper()
+	var status JobStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		env.callJSON("get_download_status", JobArgs{JobID: jobID}, &status)
+		if status.State.Finished() {
+			return status
+		}
+		if time.Now().After(deadline) {
+			env.t.Fatalf("Job did not finish, last state %s", status.State)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func stringList(v any) []string {
+	items, _ := v.([]any)
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func TestUploadAudio(t *testing.T) {
+	env := newConfiguredTestEnv(t, func(cfg *config.Config) {
+		cfg.EnableUpload = true
+		cfg.AccessKey = "access"
+		cfg.SecretKey = "secret"
+		cfg.UploadDirectory = t.TempDir()
+		cfg.UploadPartSize = 1024
+	})
+	env.fake.SetCredentials("access", "secret")
+
+	restored := archivetest.AudioContent("restored.flac", 3000)
+	if err := os.MkdirAll(filepath.Join(env.cfg.UploadDirectory, "disc1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(env.cfg.UploadDirectory, "disc1", "restored.flac"), restored, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var response map[string]any
+	args := UploadArgs{
+		Identifier: "restored-broadcast",
+		Files:      []string{"disc1/restored.flac", "../outside.flac", "missing.flac"},
+		Title:      "Restored Broadcast",
+		LicenseURL: archivetest.License,
+		Subject:    []string{"radio", "restoration"},
+	}
+	result, text := env.callWithMeta("upload_audio", args, mcp.Meta{"progressToken": "upload"})
+	if result.IsError {
+		t.Fatalf("upload_audio failed: %s", text)
+	}
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if uploaded := stringList(response["uploaded_files"]); len(uploaded) != 1 || uploaded[0] != "disc1/restored.flac" {
+		t.Errorf("Expected disc1/restored.flac to upload, got %v", response)
+	}
+	if failed, _ := response["failed_files"].([]any); len(failed) != 2 {
+		t.Errorf("Expected the escaping and missing files to fail, got %v", response["failed_files"])
+	}
+
+	var metadata MetadataOutput
+	env.callJSON("get_metadata", MetadataArgs{Identifier: "restored-broadcast"}, &metadata)
+	if metadata.Metadata.Title.String() != "Restored Broadcast" || metadata.Metadata.MediaType != "audio" || metadata.Metadata.LicenseURL.String() != archivetest.License {
+		t.Errorf("Expected item created from upload metadata, got %+v", metadata.Metadata)
+	}
+	if len(metadata.Files) != 1 || metadata.Files[0].SizeBytes != 3000 {
+		t.Errorf("Expected the uploaded file in the item, got %+v", metadata.Files)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		notifications := env.progressNotifications()
+		if len(notifications) > 0 && notifications[len(notifications)-1].Progress == 3000 {
+			if !strings.HasPrefix(notifications[0].Message, "Uploading") {
+				t.Errorf("Expected upload progress messages, got %q", notifications[0].Message)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected upload progress to reach 3000 bytes, got %d notifications", len(notifications))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUploadAudioDisabled(t *testing.T) {
+	env := newTestEnv(t)
+
+	tools, err := env.session.ListTools(env.ctx, nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	for _, tool := range tools.Tools {
+		if tool.Name == "upload_audio" {
+			t.Error("Expected upload_audio to be hidden unless IA_ENABLE_UPLOAD is set")
+		}
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	item := archivetest.AudioItem("curated-item", "Old Title",
+		archivetest.AudioFile("track01.mp3", "VBR MP3", 128),
+	)
+	env := newConfiguredTestEnv(t, func(cfg *config.Config) {
+		cfg.AccessKey = "access"
+		cfg.SecretKey = "secret"
+	}, item)
+	env.fake.SetCredentials("access", "secret")
+
+	args := UpdateMetadataArgs{
+		Identifier: "curated-item",
+		Set:        map[string]any{"title": "New Title", "creator": "Archivetest Players"},
+		Files:      []FileMetadataArgs{{Name: "track01.mp3", Set: map[string]any{"title": "Opening"}}},
+	}
+
+	var preview UpdateMetadataOutput
+	env.callJSON("update_metadata", args, &preview)
+	if preview.Committed || len(preview.Targets) != 2 {
+		t.Fatalf("Expected an uncommitted preview of two targets, got %+v", preview)
+	}
+	if changes := preview.Targets[0].Changes; len(changes) != 1 || changes[0].Field != "title" || changes[0].Old != "Old Title" || changes[0].New != "New Title" {
+		t.Errorf("Expected only the title to change, got %+v", changes)
+	}
+	if preview.Targets[1].Target != "files/track01.mp3" || preview.Targets[1].Patch[0].Op != "add" {
+		t.Errorf("Expected a file title to be added, got %+v", preview.Targets[1])
+	}
+
+	var unchanged MetadataOutput
+	env.callJSON("get_metadata", MetadataArgs{Identifier: "curated-item"}, &unchanged)
+	if unchanged.Metadata.Title.String() != "Old Title" {
+		t.Errorf("Expected preview to leave the item alone, got %v", unchanged.Metadata.Title)
+	}
+
+	args.Commit = true
+	var committed UpdateMetadataOutput
+	env.callJSON("update_metadata", args, &committed)
+	if !committed.Committed || committed.TaskID == 0 {
+		t.Errorf("Expected committed changes with a task, got %+v", committed)
+	}
+
+	var updated MetadataOutput
+	env.callJSON("get_metadata", MetadataArgs{Identifier: "curated-item"}, &updated)
+	if updated.Metadata.Title.String() != "New Title" || updated.Files[0].Title != "Opening" {
+		t.Errorf("Expected updated metadata, got %+v / %+v", updated.Metadata, updated.Files[0])
+	}
+
+	var again UpdateMetadataOutput
+	env.callJSON("update_metadata", args, &again)
+	if again.Committed || len(again.Targets) != 0 {
+		t.Errorf("Expected nothing left to change, got %+v", again)
+	}
+
+	if result, text := env.call("update_metadata", UpdateMetadataArgs{Identifier: "curated-item", Files: []FileMetadataArgs{{Name: "nope.mp3"}}}); !result.IsError {
+		t.Errorf("Expected error for unknown file, got %s", text)
+	}
+}
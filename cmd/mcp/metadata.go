@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+)
+
+type (
+	MetadataOutput struct {
+		Identifier string               `json:"identifier"`
+		Metadata   archive.ItemMetadata `json:"metadata"`
+		Files      []FileSummary        `json:"files"`
+		Totals     ItemTotals           `json:"totals"`
+	}
+	FileSummary struct {
+		Name            string              `json:"name"`
+		Format          string              `json:"format"`
+		AudioFormat     archive.AudioFormat `json:"audio_format,omitempty"`
+		Source          string              `json:"source"`
+		Original        string              `json:"original,omitempty"`
+		SizeBytes       int64               `json:"size_bytes"`
+		Size            string              `json:"size"`
+		DurationSeconds float64             `json:"duration_seconds,omitempty"`
+		Duration        string              `json:"duration,omitempty"`
+		Title           string              `json:"title,omitempty"`
+		Track           string              `json:"track,omitempty"`
+		RequiresAuth    bool                `json:"requires_auth,omitempty"`
+	}
+	// ItemTotals counts every file for sizes, but each track only once for
+	// the running time, using the format download_audio would pick.
+	ItemTotals struct {
+		Files           int     `json:"files"`
+		AudioFiles      int     `json:"audio_files"`
+		Tracks          int     `json:"tracks"`
+		SizeBytes       int64   `json:"size_bytes"`
+		Size            string  `json:"size"`
+		DurationSeconds float64 `json:"duration_seconds"`
+		Duration        string  `json:"duration"`
+	}
+)
+
+func (d *Delegate) summarizeMetadata(identifier string, result *archive.MetadataResponse) MetadataOutput {
+	output := MetadataOutput{
+		Identifier: identifier,
+		Metadata:   result.Metadata,
+		Files:      make([]FileSummary, 0, len(result.Files)),
+	}
+
+	for _, file := range result.Files {
+		format, isAudio := file.AudioFormat()
+		output.Files = append(output.Files, FileSummary{
+			Name:            file.Name,
+			Format:          file.Format,
+			AudioFormat:     format,
+			Source:          file.Source,
+			Original:        file.OriginalName(),
+			SizeBytes:       file.SizeBytes(),
+			Size:            humanSize(file.SizeBytes()),
+			DurationSeconds: file.Duration().Seconds(),
+			Duration:        humanDuration(file.Duration()),
+			Title:           file.Title,
+			Track:           file.Track,
+			RequiresAuth:    file.RequiresAuth(),
+		})
+
+		output.Totals.Files++
+		output.Totals.SizeBytes += file.SizeBytes()
+		if isAudio {
+			output.Totals.AudioFiles++
+		}
+	}
+
+	var total time.Duration
+	tracks := archive.SelectAudioFiles(result.Files, d.cfg.AudioFormatPreference, false)
+	for _, track := range tracks {
+		total += track.Duration()
+	}
+	output.Totals.Tracks = len(tracks)
+	output.Totals.Size = humanSize(output.Totals.SizeBytes)
+	output.Totals.DurationSeconds = total.Seconds()
+	output.Totals.Duration = humanDuration(total)
+
+	return output
+}
+
+func humanSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value := float64(bytes)
+	suffixes := []string{"KiB", "MiB", "GiB", "TiB"}
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, suffixes[i])
+}
+
+// humanDuration formats d as m:ss or h:mm:ss, or returns "" for zero.
+func humanDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	seconds := int64(d.Round(time.Second) / time.Second)
+	hours, minutes, seconds := seconds/3600, seconds/60%60, seconds%60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
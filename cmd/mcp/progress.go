@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/concat"
+)
+
+const progressInterval = 250 * time.Millisecond
+
+type downloadObserver interface {
+	begin(files []archive.FileInfo)
+	file(name string) archive.ProgressFunc
+	fileDone(name string, size int64, skipped bool)
+	fileFailed(name string, err error)
+	concat(name string, inputBytes int64) concat.ProgressFunc
+	concatDone(name string, inputBytes int64)
+}
+
+// progressReporter turns per-file download and concatenation callbacks into
+// MCP progress notifications. Progress is measured in bytes: the download
+// phase counts bytes fetched against the FileInfo.Size totals, and each
+// concatenation extends the total by the size of its input parts so the
+// reported value never decreases.
+type progressReporter struct {
+	ctx     context.Context
+	session *mcp.ServerSession
+	token   any
+	verb    string
+
+	mu       sync.Mutex
+	files    map[string]int64
+	base     int64
+	progress int64
+	total    int64
+	lastSent time.Time
+}
+
+func newProgressReporter(ctx context.Context, req *mcp.CallToolRequest) *progressReporter {
+	if req == nil || req.Params == nil || req.Session == nil {
+		return nil
+	}
+	token := req.Params.GetProgressToken()
+	if token == nil {
+		return nil
+	}
+	return &progressReporter{
+		ctx:     ctx,
+		session: req.Session,
+		token:   token,
+		verb:    "Downloading",
+		files:   make(map[string]int64),
+	}
+}
+
+func (p *progressReporter) begin(files []archive.FileInfo) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, file := range files {
+		p.total += file.SizeBytes()
+	}
+	p.send(fmt.Sprintf("%s %d files", p.verb, len(files)), true)
+}
+
+func (p *progressReporter) file(name string) archive.ProgressFunc {
+	if p == nil {
+		return nil
+	}
+	return func(written, total int64) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if written <= p.files[name] {
+			return
+		}
+		p.progress += written - p.files[name]
+		p.files[name] = written
+
+		final := total > 0 && written >= total
+		p.send(fmt.Sprintf("%s %s: %d of %d bytes", p.verb, name, written, total), final)
+	}
+}
+
+func (p *progressReporter) fileDone(name string, size int64, _ bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if size > p.files[name] {
+		p.progress += size - p.files[name]
+		p.files[name] = size
+	}
+	p.send(fmt.Sprintf("Finished %s", name), true)
+}
+
+func (p *progressReporter) fileFailed(name string, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.send(fmt.Sprintf("Failed %s: %v", name, err), true)
+}
+
+func (p *progressReporter) concat(name string, inputBytes int64) concat.ProgressFunc {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	p.base = p.progress
+	p.total += inputBytes
+	p.send(fmt.Sprintf("Concatenating %s", name), true)
+	p.mu.Unlock()
+
+	return func(written int64) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		next := p.base + min(written, inputBytes)
+		if next <= p.progress {
+			return
+		}
+		p.progress = next
+		p.send(fmt.Sprintf("Concatenating %s: %d of %d bytes", name, written, inputBytes), false)
+	}
+}
+
+func (p *progressReporter) concatDone(name string, inputBytes int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.progress = max(p.progress, p.base+inputBytes)
+	p.send(fmt.Sprintf("Concatenated %s", name), true)
+}
+
+func (p *progressReporter) send(message string, force bool) {
+	now := time.Now()
+	if !force && now.Sub(p.lastSent) < progressInterval {
+		return
+	}
+	p.lastSent = now
+
+	_ = p.session.NotifyProgress(p.ctx, &mcp.ProgressNotificationParams{
+		ProgressToken: p.token,
+		Message:       message,
+		Progress:      float64(p.progress),
+		Total:         float64(max(p.total, p.progress)),
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+)
+
+type (
+	UpdateMetadataArgs struct {
+		Identifier string             `json:"identifier" jsonschema:"Identifier of an item you own"`
+		Set        map[string]any     `json:"set,omitempty" jsonschema:"Item metadata fields to set, e.g. {\"title\": \"New title\", \"subject\": [\"jazz\", \"radio\"]}. An empty value removes the field"`
+		Remove     []string           `json:"remove,omitempty" jsonschema:"Item metadata fields to remove"`
+		Files      []FileMetadataArgs `json:"files,omitempty" jsonschema:"Per-file metadata changes"`
+		Commit     bool               `json:"commit,omitempty" jsonschema:"Submit the changes. Without it only a preview of the diff is returned"`
+	}
+	FileMetadataArgs struct {
+		Name   string         `json:"name" jsonschema:"File name within the item"`
+		Set    map[string]any `json:"set,omitempty" jsonschema:"File metadata fields to set, e.g. {\"title\": \"Track 1\"}"`
+		Remove []string       `json:"remove,omitempty" jsonschema:"File metadata fields to remove"`
+	}
+	TargetChanges struct {
+		Target  string                   `json:"target"`
+		Changes []archive.FieldChange    `json:"changes"`
+		Patch   []archive.PatchOperation `json:"patch"`
+	}
+	UpdateMetadataOutput struct {
+		Identifier string          `json:"identifier"`
+		Committed  bool            `json:"committed"`
+		Targets    []TargetChanges `json:"targets"`
+		TaskID     int64           `json:"task_id,omitempty"`
+		Log        string          `json:"log,omitempty"`
+		Note       string          `json:"note,omitempty"`
+	}
+)
+
+func (d *Delegate) addUpdateMetadataTool() {
+	mcp.AddTool(d.server, &mcp.Tool{
+		Name:        "update_metadata",
+		Description: "Preview or submit metadata changes for an Internet Archive item you own and its files. Returns a diff against the current metadata; pass commit=true to apply it",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args UpdateMetadataArgs) (*mcp.CallToolResult, any, error) {
+		output, err := d.updateMetadata(ctx, args)
+		if err != nil {
+			return errorResult("Failed to update metadata: %s", describeError(err)), nil, nil
+		}
+		return jsonResult(output, "metadata changes"), nil, nil
+	})
+}
+
+func (d *Delegate) updateMetadata(ctx context.Context, args UpdateMetadataArgs) (*UpdateMetadataOutput, error) {
+	current, err := d.client.GetMetadataContext(ctx, args.Identifier)
+	if err != nil && !errors.Is(err, archive.ErrItemRestricted) {
+		return nil, err
+	}
+
+	output := &UpdateMetadataOutput{Identifier: args.Identifier, Targets: []TargetChanges{}}
+	var changes []archive.MetadataChange
+	addTarget := func(target string, update archive.MetadataUpdate, existing any) error {
+		fields, err := update.Diff(existing)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		patch := archive.Patch(fields)
+		output.Targets = append(output.Targets, TargetChanges{Target: target, Changes: fields, Patch: patch})
+		changes = append(changes, archive.MetadataChange{Target: target, Patch: patch})
+		return nil
+	}
+
+	if err := addTarget(archive.MetadataTarget, archive.MetadataUpdate{Set: args.Set, Remove: args.Remove}, current.Metadata); err != nil {
+		return nil, err
+	}
+	for _, file := range args.Files {
+		info, ok := findFile(current.Files, file.Name)
+		if !ok {
+			return nil, &archive.ItemError{Identifier: args.Identifier, Err: errors.New("no file named " + file.Name)}
+		}
+		if err := addTarget(archive.FileTarget(file.Name), archive.MetadataUpdate{Set: file.Set, Remove: file.Remove}, info); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(changes) == 0:
+		output.Note = "The metadata already matches; there is nothing to change"
+	case !args.Commit:
+		output.Note = "Preview only. Call update_metadata again with commit=true to apply these changes"
+	default:
+		result, err := d.client.UpdateMetadata(ctx, args.Identifier, changes...)
+		if err != nil {
+			return nil, err
+		}
+		output.Committed = true
+		output.TaskID = result.TaskID
+		output.Log = result.Log
+		output.Note = "archive.org applies metadata changes in a background task; get_metadata shows them once it finishes"
+	}
+	return output, nil
+}
+
+func findFile(files []archive.FileInfo, name string) (archive.FileInfo, bool) {
+	for _, file := range files {
+		if file.Name == name {
+			return file, true
+		}
+	}
+	return archive.FileInfo{}, false
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/safepath"
+)
+
+const defaultUploadCollection = "opensource_audio"
+
+type UploadArgs struct {
+	Identifier  string   `json:"identifier" jsonschema:"Identifier of the item to create, or of an existing item of yours to add files to"`
+	Files       []string `json:"files" jsonschema:"Files to upload, as paths relative to the configured upload directory. Subdirectories are kept in the item"`
+	Title       string   `json:"title,omitempty" jsonschema:"Item title"`
+	Creator     string   `json:"creator,omitempty" jsonschema:"Item creator"`
+	Date        string   `json:"date,omitempty" jsonschema:"Item date as YYYY, YYYY-MM or YYYY-MM-DD"`
+	Description string   `json:"description,omitempty" jsonschema:"Item description"`
+	Language    string   `json:"language,omitempty" jsonschema:"Item language, e.g. eng"`
+	LicenseURL  string   `json:"license_url,omitempty" jsonschema:"License URL, e.g. https://creativecommons.org/licenses/by/4.0/"`
+	Collection  []string `json:"collection,omitempty" jsonschema:"Collections to place the item in (default: opensource_audio)"`
+	Subject     []string `json:"subject,omitempty" jsonschema:"Subject tags"`
+}
+
+func (d *Delegate) addUploadTool() {
+	mcp.AddTool(d.server, &mcp.Tool{
+		Name:        "upload_audio",
+		Description: "Upload audio files to an Internet Archive item, creating the item with the given metadata if it does not exist",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args UploadArgs) (*mcp.CallToolResult, any, error) {
+		if err := archive.ValidateIdentifier(args.Identifier); err != nil {
+			return errorResult("Upload failed: %v", err), nil, nil
+		}
+		if len(args.Files) == 0 {
+			return errorResult("Upload failed: no files given"), nil, nil
+		}
+
+		reporter := newProgressReporter(ctx, req)
+		if reporter != nil {
+			reporter.verb = "Uploading"
+		}
+		response := d.uploadFiles(ctx, args, reporter)
+
+		result := jsonResult(response, "response")
+		if _, ok := response["uploaded_files"]; !ok {
+			result.IsError = true
+		}
+		return result, nil, nil
+	})
+}
+
+func (d *Delegate) uploadFiles(ctx context.Context, args UploadArgs, observer downloadObserver) map[string]interface{} {
+	meta := archive.UploadMetadata{
+		Title:       args.Title,
+		Creator:     args.Creator,
+		Date:        args.Date,
+		Description: args.Description,
+		MediaType:   "audio",
+		Language:    args.Language,
+		LicenseURL:  args.LicenseURL,
+		Collection:  args.Collection,
+		Subject:     args.Subject,
+	}
+	if len(meta.Collection) == 0 {
+		meta.Collection = []string{defaultUploadCollection}
+	}
+
+	paths := make([]string, len(args.Files))
+	errs := make([]error, len(args.Files))
+	files := make([]archive.FileInfo, len(args.Files))
+	for i, name := range args.Files {
+		files[i].Name = name
+		paths[i], errs[i] = safepath.Join(d.cfg.UploadDirectory, name)
+		if errs[i] != nil {
+			continue
+		}
+		info, err := os.Stat(paths[i])
+		switch {
+		case err != nil:
+			errs[i] = err
+		case !info.Mode().IsRegular():
+			errs[i] = fmt.Errorf("%s is not a regular file", name)
+		default:
+			files[i].Size = strconv.FormatInt(info.Size(), 10)
+		}
+	}
+	observer.begin(files)
+
+	var uploaded []string
+	var failed []FileError
+	for i, file := range files {
+		err := errs[i]
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			err = d.client.UploadFile(ctx, args.Identifier, file.Name, paths[i], meta, observer.file(file.Name))
+		}
+		if err != nil {
+			observer.fileFailed(file.Name, err)
+			failed = append(failed, FileError{Name: file.Name, Error: describeError(err)})
+			continue
+		}
+
+		observer.fileDone(file.Name, file.SizeBytes(), false)
+		uploaded = append(uploaded, file.Name)
+	}
+
+	response := map[string]interface{}{
+		"identifier":  args.Identifier,
+		"details_url": "https://archive.org/details/" + args.Identifier,
+	}
+	if len(uploaded) > 0 {
+		response["uploaded_files"] = uploaded
+		response["note"] = "archive.org processes new uploads in the background; they can take a few minutes to appear"
+	}
+	if len(failed) > 0 {
+		response["failed_files"] = failed
+	}
+	return response
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/safepath"
+)
+
+const (
+	verifyOK           = "verified"
+	verifyMismatch     = "mismatch"
+	verifyUnverifiable = "unverifiable"
+	verifyFailed       = "error"
+)
+
+type (
+	VerifyItemArgs struct {
+		Identifier string `json:"identifier" jsonschema:"Identifier of an item previously downloaded with download_audio"`
+	}
+	FileVerification struct {
+		Name    string   `json:"name"`
+		Status  string   `json:"status"`
+		Checked []string `json:"checked,omitempty"`
+		Error   string   `json:"error,omitempty"`
+	}
+	VerifyItemOutput struct {
+		Identifier   string             `json:"identifier"`
+		Directory    string             `json:"directory"`
+		Files        []FileVerification `json:"files"`
+		Verified     int                `json:"verified"`
+		Mismatched   int                `json:"mismatched"`
+		Unverifiable int                `json:"unverifiable"`
+		// Missing lists the audio files download_audio would fetch that are
+		// not on disk.
+		Missing []string `json:"missing,omitempty"`
+		Note    string   `json:"note,omitempty"`
+	}
+)
+
+func (d *Delegate) addVerifyTool() {
+	mcp.AddTool(d.server, &mcp.Tool{
+		Name:        "verify_item",
+		Description: "Re-check the files of an already downloaded item against the sizes and MD5, SHA1 and CRC32 checksums in its current metadata",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args VerifyItemArgs) (*mcp.CallToolResult, any, error) {
+		output, err := d.verifyItem(ctx, args)
+		if err != nil {
+			return errorResult("Verification failed: %s", describeError(err)), nil, nil
+		}
+		return jsonResult(output, "verification"), nil, nil
+	})
+}
+
+func (d *Delegate) verifyItem(ctx context.Context, args VerifyItemArgs) (*VerifyItemOutput, error) {
+	if err := archive.ValidateIdentifier(args.Identifier); err != nil {
+		return nil, err
+	}
+
+	dir, err := safepath.Join(d.cfg.DownloadDirectory, args.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("nothing has been downloaded for %s", args.Identifier)
+	}
+
+	metadata, err := d.client.GetMetadataContext(ctx, args.Identifier)
+	if err != nil && !errors.Is(err, archive.ErrItemRestricted) {
+		return nil, err
+	}
+
+	output := &VerifyItemOutput{Identifier: args.Identifier, Directory: dir, Files: []FileVerification{}}
+	for _, file := range metadata.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		path, err := safepath.Join(dir, file.Name)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		result := FileVerification{Name: file.Name, Checked: archive.NewVerifier(file).Checked()}
+		err = archive.VerifyFile(path, file)
+		switch {
+		case err == nil:
+			result.Status = verifyOK
+			output.Verified++
+		case errors.Is(err, archive.ErrChecksumMismatch):
+			result.Status = verifyMismatch
+			result.Error = err.Error()
+			output.Mismatched++
+		case errors.Is(err, archive.ErrNoChecksums):
+			result.Status = verifyUnverifiable
+			output.Unverifiable++
+		default:
+			result.Status = verifyFailed
+			result.Error = err.Error()
+		}
+		output.Files = append(output.Files, result)
+	}
+
+	for _, file := range archive.SelectAudioFiles(metadata.Files, d.cfg.AudioFormatPreference, false) {
+		path, err := safepath.Join(dir, file.Name)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			output.Missing = append(output.Missing, file.Name)
+		}
+	}
+
+	switch {
+	case output.Mismatched > 0:
+		output.Note = "Run download_audio again to replace the mismatched files"
+	case len(output.Missing) > 0:
+		output.Note = "Some files are not on disk; they may have been concatenated, or download_audio can fetch them"
+	}
+	return output, nil
+}
@@ -0,0 +1,49 @@
+package archivetest
+
+import (
+	"fmt"
+
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+)
+
+const License = "http://creativecommons.org/licenses/by/3.0/"
+
+// AudioContent returns deterministic bytes standing in for an audio file.
+func AudioContent(name string, size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = name[i%len(name)] ^ byte(i)
+	}
+	return content
+}
+
+func AudioItem(identifier, title string, files ...File) Item {
+	return Item{
+		Metadata: archive.ItemMetadata{
+			Identifier: identifier,
+			Title:      archive.StringOrSlice{title},
+			Creator:    archive.StringOrSlice{"Archivetest Players"},
+			Date:       archive.StringOrSlice{"1944-06-06"},
+			MediaType:  "audio",
+			LicenseURL: archive.StringOrSlice{License},
+		},
+		Files: files,
+	}
+}
+
+func AudioFile(name, format string, size int) File {
+	return File{
+		Info:    archive.FileInfo{Name: name, Format: format},
+		Content: AudioContent(name, size),
+	}
+}
+
+// MultiPartItem returns an item whose audio is split into numbered MP3 parts,
+// named like archive.org broadcast recordings: <base>_Part_1.mp3 and so on.
+func MultiPartItem(identifier, base string, parts, size int) Item {
+	files := make([]File, 0, parts)
+	for i := 1; i <= parts; i++ {
+		files = append(files, AudioFile(fmt.Sprintf("%s_Part_%d.mp3", base, i), "VBR MP3", size))
+	}
+	return AudioItem(identifier, base, files...)
+}
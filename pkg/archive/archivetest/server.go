@@ -0,0 +1,789 @@
+// Package archivetest provides an in-process stand-in for the archive.org
+// search, metadata and download endpoints, for tests that must not touch the
+// network.
+package archivetest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+)
+
+const (
+	SearchPath   = "/advancedsearch.php"
+	ScrapePath   = "/services/search/v1/scrape"
+	MetadataPath = "/metadata/"
+	DownloadPath = "/download/"
+	S3Path       = "/s3/"
+)
+
+type (
+	File struct {
+		Info    archive.FileInfo
+		Content []byte
+		// Status makes downloads of this file fail with the given HTTP status.
+		Status int
+		// Delay is slept between each ChunkSize bytes of the body, to emulate
+		// slow transfers.
+		Delay     time.Duration
+		ChunkSize int
+		// Corrupt serves the file with a flipped byte this many times before
+		// serving it intact, to exercise checksum verification.
+		Corrupt int
+		// NoChecksums leaves the checksums out of the item metadata, as
+		// archive.org does for some files.
+		NoChecksums bool
+	}
+	Item struct {
+		Metadata archive.ItemMetadata
+		Files    []File
+		// Status makes metadata requests for this item fail with the given
+		// HTTP status.
+		Status int
+		// Dark answers metadata requests the way archive.org does for
+		// withdrawn items.
+		Dark bool
+	}
+	Request struct {
+		Method string
+		Path   string
+		Query  string
+		Header http.Header
+	}
+	Server struct {
+		*httptest.Server
+
+		mu       sync.Mutex
+		items    map[string]*Item
+		order    []string
+		requests []Request
+		auth     string
+		uploads  map[string]*multipartUpload
+		nextID   int
+	}
+	multipartUpload struct {
+		identifier string
+		name       string
+		header     http.Header
+		parts      map[int][]byte
+	}
+)
+
+// NewServer starts a fake archive.org serving items. Files without a size or
+// checksums get them computed from their content, as the real metadata API
+// reports them. Unknown identifiers get the empty object archive.org returns.
+func NewServer(items ...Item) *Server {
+	s := &Server{items: make(map[string]*Item), uploads: make(map[string]*multipartUpload)}
+	for _, item := range items {
+		s.AddItem(item)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(SearchPath, s.handleSearch)
+	mux.HandleFunc(ScrapePath, s.handleScrape)
+	mux.HandleFunc(MetadataPath, s.handleMetadata)
+	mux.HandleFunc(DownloadPath, s.handleDownload)
+	mux.HandleFunc(S3Path, s.handleS3)
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+func (s *Server) AddItem(item Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range item.Files {
+		fillFileInfo(&item.Files[i])
+	}
+
+	identifier := item.Metadata.Identifier
+	if _, exists := s.items[identifier]; !exists {
+		s.order = append(s.order, identifier)
+	}
+	s.items[identifier] = &item
+}
+
+// FastRetryPolicy keeps retries of injected failures from slowing tests down.
+var FastRetryPolicy = archive.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func (s *Server) ClientOptions() []archive.Option {
+	return []archive.Option{
+		archive.WithSearchURL(s.URL + SearchPath),
+		archive.WithScrapeURL(s.URL + ScrapePath),
+		archive.WithMetadataURL(s.URL + strings.TrimSuffix(MetadataPath, "/")),
+		archive.WithDownloadURL(s.URL + strings.TrimSuffix(DownloadPath, "/")),
+		archive.WithS3URL(s.URL + strings.TrimSuffix(S3Path, "/")),
+		archive.WithRetryPolicy(FastRetryPolicy),
+	}
+}
+
+// SetCredentials makes the server accept the IA-S3 keys access and secret.
+// Files marked private are then only served to requests that carry them.
+func (s *Server) SetCredentials(access, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = "LOW " + access + ":" + secret
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.auth != "" && r.Header.Get("Authorization") == s.auth
+}
+
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Header: r.Header.Clone(),
+		})
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	docs := s.searchDocs()
+
+	rows, _ := strconv.Atoi(r.URL.Query().Get("rows"))
+	if rows <= 0 {
+		rows = 50
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+
+	start := min((page-1)*rows, len(docs))
+	end := min(start+rows, len(docs))
+
+	writeJSON(w, archive.SearchAPIResponse{
+		ResponseHeader: archive.ResponseHeader{Params: map[string]interface{}{"query": r.URL.Query().Get("q")}},
+		Response: archive.SearchResponse{
+			NumFound: len(docs),
+			Start:    start,
+			Docs:     docs[start:end],
+		},
+	})
+}
+
+func (s *Server) handleScrape(w http.ResponseWriter, r *http.Request) {
+	docs := s.searchDocs()
+
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	if count <= 0 {
+		count = 100
+	}
+	start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+	start = min(max(start, 0), len(docs))
+	end := min(start+count, len(docs))
+
+	response := archive.ScrapeResponse{
+		Items: docs[start:end],
+		Count: end - start,
+		Total: len(docs),
+	}
+	if end < len(docs) {
+		response.Cursor = strconv.Itoa(end)
+	}
+	writeJSON(w, response)
+}
+
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	identifier := strings.Trim(strings.TrimPrefix(r.URL.Path, MetadataPath), "/")
+	if r.Method == http.MethodPost {
+		s.handleMetadataWrite(w, r, identifier)
+		return
+	}
+
+	s.mu.Lock()
+	item, ok := s.items[identifier]
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, map[string]interface{}{})
+		return
+	}
+	if item.Status != 0 {
+		http.Error(w, http.StatusText(item.Status), item.Status)
+		return
+	}
+	if item.Dark {
+		writeJSON(w, archive.MetadataResponse{
+			Created: time.Now().Unix(),
+			Server:  r.Host,
+			Dir:     "/items/" + identifier,
+			IsDark:  true,
+		})
+		return
+	}
+
+	files := make([]archive.FileInfo, 0, len(item.Files))
+	var size int64
+	for _, file := range item.Files {
+		files = append(files, file.Info)
+		size += int64(len(file.Content))
+	}
+
+	writeJSON(w, archive.MetadataResponse{
+		Created:         time.Now().Unix(),
+		Server:          r.Host,
+		Dir:             "/items/" + identifier,
+		ItemSize:        size,
+		ItemLastUpdated: time.Now().Unix(),
+		FilesCount:      len(files),
+		Files:           files,
+		Metadata:        item.Metadata,
+	})
+}
+
+// handleMetadataWrite emulates the metadata write API. It applies -target
+// and -patch, or -changes, to the item and its files. Only top-level add,
+// replace and remove operations are supported.
+func (s *Server) handleMetadataWrite(w http.ResponseWriter, r *http.Request, identifier string) {
+	if err := r.ParseForm(); err != nil {
+		writeWriteResult(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.authorized(r) && !s.authorizedForm(r) {
+		writeWriteResult(w, http.StatusUnauthorized, "access denied")
+		return
+	}
+
+	var changes []archive.MetadataChange
+	if encoded := r.PostForm.Get("-changes"); encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &changes); err != nil {
+			writeWriteResult(w, http.StatusBadRequest, "invalid -changes: "+err.Error())
+			return
+		}
+	} else {
+		change := archive.MetadataChange{Target: r.PostForm.Get("-target")}
+		if err := json.Unmarshal([]byte(r.PostForm.Get("-patch")), &change.Patch); err != nil {
+			writeWriteResult(w, http.StatusBadRequest, "invalid -patch: "+err.Error())
+			return
+		}
+		changes = append(changes, change)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[identifier]
+	if !ok {
+		writeWriteResult(w, http.StatusNotFound, "item not found")
+		return
+	}
+
+	metadata := item.Metadata
+	files := make([]File, len(item.Files))
+	copy(files, item.Files)
+	changed := false
+	for _, change := range changes {
+		var err error
+		var patched bool
+		switch {
+		case change.Target == archive.MetadataTarget:
+			patched, err = applyPatch(&metadata, change.Patch)
+		case strings.HasPrefix(change.Target, "files/"):
+			name := strings.TrimPrefix(change.Target, "files/")
+			err = fmt.Errorf("no file %s", name)
+			for i := range files {
+				if files[i].Info.Name == name {
+					patched, err = applyPatch(&files[i].Info, change.Patch)
+				}
+			}
+		default:
+			err = fmt.Errorf("unsupported target %q", change.Target)
+		}
+		if err != nil {
+			writeWriteResult(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		changed = changed || patched
+	}
+	if !changed {
+		writeWriteResult(w, http.StatusBadRequest, "no changes to _meta.xml")
+		return
+	}
+
+	item.Metadata = metadata
+	item.Files = files
+	s.nextID++
+	writeJSON(w, archive.MetadataWriteResponse{
+		Success: true,
+		TaskID:  int64(s.nextID),
+		Log:     fmt.Sprintf("%s/log/%d", s.URL, s.nextID),
+	})
+}
+
+func (s *Server) authorizedForm(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.auth != "" && s.auth == "LOW "+r.PostForm.Get("access")+":"+r.PostForm.Get("secret")
+}
+
+// applyPatch applies top-level JSON Patch operations to target, which must
+// marshal to a JSON object, and reports whether anything changed.
+func applyPatch(target any, patch []archive.PatchOperation) (bool, error) {
+	data, err := json.Marshal(target)
+	if err != nil {
+		return false, err
+	}
+	object := map[string]any{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return false, err
+	}
+	before, err := json.Marshal(object)
+	if err != nil {
+		return false, err
+	}
+
+	for _, op := range patch {
+		field := strings.TrimPrefix(op.Path, "/")
+		if field == op.Path || strings.Contains(field, "/") {
+			return false, fmt.Errorf("unsupported patch path %q", op.Path)
+		}
+		field = strings.NewReplacer("~1", "/", "~0", "~").Replace(field)
+
+		switch op.Op {
+		case "add":
+			object[field] = op.Value
+		case "replace", "remove":
+			if _, ok := object[field]; !ok {
+				return false, fmt.Errorf("cannot %s missing field %s", op.Op, field)
+			}
+			if op.Op == "remove" {
+				delete(object, field)
+			} else {
+				object[field] = op.Value
+			}
+		default:
+			return false, fmt.Errorf("unsupported patch operation %q", op.Op)
+		}
+	}
+
+	patched, err := json.Marshal(object)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(patched, before) {
+		return false, nil
+	}
+	// Decode into a fresh value so removed fields are cleared.
+	fresh := reflect.New(reflect.TypeOf(target).Elem())
+	if err := json.Unmarshal(patched, fresh.Interface()); err != nil {
+		return false, err
+	}
+	reflect.ValueOf(target).Elem().Set(fresh.Elem())
+	return true, nil
+}
+
+func writeWriteResult(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(archive.MetadataWriteResponse{Success: false, Error: message})
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	identifier, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, DownloadPath), "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	file := s.file(identifier, name)
+	var content []byte
+	if file != nil {
+		content = file.Content
+		if file.Corrupt > 0 && len(content) > 0 {
+			file.Corrupt--
+			content = append([]byte(nil), content...)
+			content[len(content)/2] ^= 0xff
+		}
+	}
+	s.mu.Unlock()
+
+	if file == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if file.Status != 0 {
+		http.Error(w, http.StatusText(file.Status), file.Status)
+		return
+	}
+	if file.Info.RequiresAuth() && !s.authorized(r) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	var out http.ResponseWriter = w
+	if file.Delay > 0 {
+		out = &slowWriter{ResponseWriter: w, r: r, delay: file.Delay, chunk: max(file.ChunkSize, 1)}
+	}
+	http.ServeContent(out, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// handleS3 answers credential checks and emulates the IA-S3 upload API:
+// PUT creates an item from its x-archive-meta-* headers when
+// x-archive-auto-make-bucket is set and adds the file to it, and the
+// ?uploads, ?partNumber and ?uploadId requests implement multipart uploads.
+func (s *Server) handleS3(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("check_auth") == "" {
+		s.handleUpload(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(archive.CredentialsResponse{Authorized: false})
+		return
+	}
+
+	access, _, _ := strings.Cut(strings.TrimPrefix(r.Header.Get("Authorization"), "LOW "), ":")
+	writeJSON(w, archive.CredentialsResponse{
+		Authorized: true,
+		AccessKey:  access,
+		Username:   "archivetest@example.org",
+		ScreenName: "archivetest",
+	})
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	identifier, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, S3Path), "/")
+	if !ok || identifier == "" || name == "" {
+		writeS3Error(w, http.StatusBadRequest, "InvalidURI")
+		return
+	}
+	if !s.authorized(r) {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.mu.Lock()
+		s.nextID++
+		uploadID = strconv.Itoa(s.nextID)
+		s.uploads[uploadID] = &multipartUpload{identifier: identifier, name: name, header: r.Header.Clone(), parts: make(map[int][]byte)}
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+
+	case r.Method == http.MethodPut && uploadID != "":
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		body, ok := readUploadBody(w, r)
+		if !ok {
+			return
+		}
+
+		s.mu.Lock()
+		upload := s.uploads[uploadID]
+		if upload != nil && err == nil {
+			upload.parts[number] = body
+		}
+		s.mu.Unlock()
+
+		if upload == nil || err != nil {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		w.Header().Set("ETag", etag(body))
+
+	case r.Method == http.MethodPost && uploadID != "":
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+
+		s.mu.Lock()
+		upload := s.uploads[uploadID]
+		delete(s.uploads, uploadID)
+		s.mu.Unlock()
+
+		if upload == nil {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var content []byte
+		for _, part := range complete.Parts {
+			data, ok := upload.parts[part.PartNumber]
+			if !ok || etag(data) != part.ETag {
+				writeS3Error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			content = append(content, data...)
+		}
+		s.storeUpload(w, upload.identifier, upload.name, upload.header, content)
+
+	case r.Method == http.MethodDelete && uploadID != "":
+		s.mu.Lock()
+		delete(s.uploads, uploadID)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		body, ok := readUploadBody(w, r)
+		if !ok {
+			return
+		}
+		s.storeUpload(w, identifier, name, r.Header, body)
+
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// readUploadBody reads a request body and checks it against its Content-MD5
+// header, as S3 does.
+func readUploadBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return nil, false
+	}
+	if digest := r.Header.Get("Content-MD5"); digest != "" {
+		sum := md5.Sum(body)
+		if digest != base64.StdEncoding.EncodeToString(sum[:]) {
+			writeS3Error(w, http.StatusBadRequest, "BadDigest")
+			return nil, false
+		}
+	}
+	return body, true
+}
+
+func (s *Server) storeUpload(w http.ResponseWriter, identifier, name string, header http.Header, content []byte) {
+	file := File{Info: archive.FileInfo{Name: name, Format: formatFor(name)}, Content: content}
+	fillFileInfo(&file)
+
+	s.mu.Lock()
+	item, exists := s.items[identifier]
+	if !exists && header.Get("x-archive-auto-make-bucket") != "1" {
+		s.mu.Unlock()
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if !exists {
+		item = &Item{Metadata: metadataFromHeaders(identifier, header)}
+		s.items[identifier] = item
+		s.order = append(s.order, identifier)
+	}
+	replaced := false
+	for i := range item.Files {
+		if item.Files[i].Info.Name == name {
+			item.Files[i] = file
+			replaced = true
+		}
+	}
+	if !replaced {
+		item.Files = append(item.Files, file)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", etag(content))
+}
+
+// metadataFromHeaders decodes x-archive-meta-* headers the way IA-S3 does
+// when it creates an item.
+func metadataFromHeaders(identifier string, header http.Header) archive.ItemMetadata {
+	var names []string
+	for key := range header {
+		if metaHeader.MatchString(strings.ToLower(key)) {
+			names = append(names, key)
+		}
+	}
+	// Numbered headers sort into their meta01, meta02 order.
+	sort.Strings(names)
+
+	values := map[string][]string{}
+	for _, key := range names {
+		field := strings.ReplaceAll(metaHeader.FindStringSubmatch(strings.ToLower(key))[1], "--", "_")
+		value := header.Get(key)
+		if strings.HasPrefix(value, "uri(") && strings.HasSuffix(value, ")") {
+			if decoded, err := url.PathUnescape(value[4 : len(value)-1]); err == nil {
+				value = decoded
+			}
+		}
+		values[field] = append(values[field], value)
+	}
+
+	first := func(field string) string {
+		if len(values[field]) == 0 {
+			return ""
+		}
+		return values[field][0]
+	}
+	meta := archive.ItemMetadata{
+		Identifier:  identifier,
+		Title:       values["title"],
+		Creator:     values["creator"],
+		Date:        values["date"],
+		Description: values["description"],
+		MediaType:   first("mediatype"),
+		LicenseURL:  values["licenseurl"],
+		Subject:     values["subject"],
+		Collection:  values["collection"],
+		Language:    values["language"],
+	}
+	return meta
+}
+
+var metaHeader = regexp.MustCompile(`^x-archive-meta\d*-(.+)$`)
+
+func formatFor(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".flac":
+		return "Flac"
+	case ".wav":
+		return "WAVE"
+	case ".mp3":
+		return "VBR MP3"
+	case ".ogg":
+		return "Ogg Vorbis"
+	default:
+		return "Unknown"
+	}
+}
+
+func etag(content []byte) string {
+	sum := md5.Sum(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+}
+
+func (s *Server) file(identifier, name string) *File {
+	item, ok := s.items[identifier]
+	if !ok {
+		return nil
+	}
+	for i := range item.Files {
+		if item.Files[i].Info.Name == name {
+			return &item.Files[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) searchDocs() []archive.SearchResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := make([]archive.SearchResult, 0, len(s.order))
+	for _, identifier := range s.order {
+		meta := s.items[identifier].Metadata
+		docs = append(docs, archive.SearchResult{
+			Identifier:  meta.Identifier,
+			Title:       meta.Title,
+			Description: meta.Description,
+			Creator:     meta.Creator,
+			Date:        meta.Date,
+			Year:        meta.Year,
+			Subject:     meta.Subject,
+			Collection:  meta.Collection,
+			Language:    meta.Language,
+			LicenseURL:  meta.LicenseURL,
+			MediaType:   meta.MediaType,
+		})
+	}
+	sort.SliceStable(docs, func(i, j int) bool { return docs[i].Identifier < docs[j].Identifier })
+	return docs
+}
+
+func fillFileInfo(file *File) {
+	if file.Info.Source == "" {
+		file.Info.Source = "original"
+	}
+	if file.Info.Size == "" {
+		file.Info.Size = strconv.Itoa(len(file.Content))
+	}
+	if file.NoChecksums {
+		return
+	}
+	if file.Info.MD5 == "" {
+		sum := md5.Sum(file.Content)
+		file.Info.MD5 = hex.EncodeToString(sum[:])
+	}
+	if file.Info.SHA1 == "" {
+		sum := sha1.Sum(file.Content)
+		file.Info.SHA1 = hex.EncodeToString(sum[:])
+	}
+	if file.Info.CRC32 == "" {
+		file.Info.CRC32 = fmt.Sprintf("%08x", crc32.ChecksumIEEE(file.Content))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type slowWriter struct {
+	http.ResponseWriter
+	r     *http.Request
+	delay time.Duration
+	chunk int
+}
+
+func (s *slowWriter) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		end := min(written+s.chunk, len(b))
+		n, err := s.ResponseWriter.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if f, ok := s.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+		select {
+		case <-s.r.Context().Done():
+			return written, s.r.Context().Err()
+		case <-time.After(s.delay):
+		}
+	}
+	return written, nil
+}
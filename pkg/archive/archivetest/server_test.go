@@ -0,0 +1,197 @@
+package archivetest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+)
+
+func TestServerServesItems(t *testing.T) {
+	item := MultiPartItem("fixture-item", "Fixture", 3, 256)
+	server := NewServer(item)
+	defer server.Close()
+
+	client := archive.NewClient("", server.ClientOptions()...)
+
+	metadata, err := client.GetMetadata("fixture-item")
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if len(metadata.Files) != 3 || metadata.Files[0].MD5 == "" || metadata.Files[0].Size != "256" {
+		t.Fatalf("Expected filled-in file info, got %+v", metadata.Files)
+	}
+
+	destPath := filepath.Join(t.TempDir(), "part.mp3")
+	if err := client.DownloadContext(context.Background(), "fixture-item", metadata.Files[1], destPath, nil); err != nil {
+		t.Fatalf("DownloadContext failed: %v", err)
+	}
+	data, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatalf("Downloaded file not found: %v", err)
+	}
+	if string(data) != string(item.Files[1].Content) {
+		t.Error("Downloaded content does not match fixture")
+	}
+
+	search, err := client.Search("fixture", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if search.Response.NumFound != 1 || search.Response.Docs[0].Identifier != "fixture-item" {
+		t.Errorf("Unexpected search response: %+v", search.Response)
+	}
+
+	if len(server.Requests()) != 3 {
+		t.Errorf("Expected 3 recorded requests, got %d", len(server.Requests()))
+	}
+}
+
+func TestServerFailureModes(t *testing.T) {
+	broken := AudioItem("broken-item", "Broken", AudioFile("a.mp3", "VBR MP3", 16))
+	broken.Status = 503
+	slow := AudioItem("slow-item", "Slow", AudioFile("slow.mp3", "VBR MP3", 4096))
+	slow.Files[0].Delay = 50 * time.Millisecond
+	slow.Files[0].ChunkSize = 64
+
+	dark := AudioItem("dark-item", "Dark")
+	dark.Dark = true
+	restricted := AudioItem("restricted-item", "Restricted", AudioFile("lent.mp3", "VBR MP3", 128))
+	restricted.Metadata.AccessRestrictedItem = "true"
+
+	server := NewServer(broken, slow, dark, restricted)
+	defer server.Close()
+
+	client := archive.NewClient("", server.ClientOptions()...)
+
+	if _, err := client.GetMetadata("missing-item"); !errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing item, got %v", err)
+	}
+
+	if _, err := client.GetMetadata("dark-item"); !errors.Is(err, archive.ErrItemDark) {
+		t.Errorf("Expected ErrItemDark, got %v", err)
+	}
+
+	lent, err := client.GetMetadata("restricted-item")
+	if !errors.Is(err, archive.ErrItemRestricted) {
+		t.Errorf("Expected ErrItemRestricted, got %v", err)
+	}
+	if lent == nil || len(lent.Files) != 1 {
+		t.Errorf("Expected restricted item metadata alongside the error, got %+v", lent)
+	}
+
+	if _, err := client.GetMetadata("broken-item"); err == nil {
+		t.Error("Expected error for 503 item")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	destPath := filepath.Join(t.TempDir(), "slow.mp3")
+	if err := client.DownloadContext(ctx, "slow-item", slow.Files[0].Info, destPath, nil); err == nil {
+		t.Error("Expected slow download to time out")
+	}
+}
+
+func TestServerCorruptsDownloads(t *testing.T) {
+	flaky := AudioItem("flaky-item", "Flaky", AudioFile("once.mp3", "VBR MP3", 512), AudioFile("always.mp3", "VBR MP3", 512))
+	flaky.Files[0].Corrupt = 1
+	flaky.Files[1].Corrupt = 100
+
+	server := NewServer(flaky)
+	defer server.Close()
+
+	client := archive.NewClient("", server.ClientOptions()...)
+	metadata, err := client.GetMetadata("flaky-item")
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := client.DownloadContext(context.Background(), "flaky-item", metadata.Files[0], filepath.Join(dir, "once.mp3"), nil); err != nil {
+		t.Errorf("Expected the download to recover from one corrupted transfer, got %v", err)
+	}
+	if err := archive.VerifyFile(filepath.Join(dir, "once.mp3"), metadata.Files[0]); err != nil {
+		t.Errorf("Expected the recovered file to verify, got %v", err)
+	}
+
+	err = client.DownloadContext(context.Background(), "flaky-item", metadata.Files[1], filepath.Join(dir, "always.mp3"), nil)
+	if !errors.Is(err, archive.ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "always.mp3")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file after failed verification, stat returned: %v", err)
+	}
+
+	downloads := map[string]int{}
+	for _, request := range server.Requests() {
+		downloads[request.Path]++
+	}
+	if downloads[DownloadPath+"flaky-item/once.mp3"] != 2 || downloads[DownloadPath+"flaky-item/always.mp3"] != 3 {
+		t.Errorf("Expected 2 and 3 download attempts, got %v", downloads)
+	}
+}
+
+func TestServerAcceptsUploads(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetCredentials("access", "secret")
+
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.flac")
+	large := filepath.Join(dir, "large.mp3")
+	largeContent := AudioContent("large.mp3", 2500)
+	if err := os.WriteFile(small, AudioContent("small.flac", 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(large, largeContent, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := archive.UploadMetadata{
+		Title:      "Restored Broadcast",
+		MediaType:  "audio",
+		Collection: []string{"opensource_audio", "radio"},
+		Subject:    []string{"news", "restoration"},
+	}
+	client := archive.NewClient("access:secret", append(server.ClientOptions(), archive.WithUploadPartSize(1024))...)
+
+	if err := client.UploadFile(context.Background(), "restored-item", "small.flac", small, meta, nil); err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+
+	var progress []int64
+	err := client.UploadFile(context.Background(), "restored-item", "disc1/large.mp3", large, meta, func(written, total int64) {
+		progress = append(progress, written)
+	})
+	if err != nil {
+		t.Fatalf("multipart UploadFile failed: %v", err)
+	}
+	if len(progress) != 4 || progress[3] != int64(len(largeContent)) {
+		t.Errorf("Expected progress per part, got %v", progress)
+	}
+
+	metadata, err := client.GetMetadata("restored-item")
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if metadata.Metadata.Title.String() != "Restored Broadcast" || metadata.Metadata.Subject.String() != "news; restoration" {
+		t.Errorf("Expected metadata from upload headers, got %+v", metadata.Metadata)
+	}
+	if len(metadata.Files) != 2 || metadata.Files[1].Name != "disc1/large.mp3" || metadata.Files[1].Size != "2500" {
+		t.Fatalf("Expected both uploads in the item, got %+v", metadata.Files)
+	}
+
+	destPath := filepath.Join(t.TempDir(), "large.mp3")
+	if err := client.DownloadContext(context.Background(), "restored-item", metadata.Files[1], destPath, nil); err != nil {
+		t.Fatalf("DownloadContext of uploaded file failed: %v", err)
+	}
+
+	anonymous := archive.NewClient("access:wrong", server.ClientOptions()...)
+	if err := anonymous.UploadFile(context.Background(), "restored-item", "small.flac", small, meta, nil); !errors.Is(err, archive.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized with wrong keys, got %v", err)
+	}
+}
@@ -1,91 +1,377 @@
 package archive
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
 )
 
-type Client struct {
-	HTTPClient *resty.Client
-	apiKey     string
+const (
+	partSuffix        = ".part"
+	maxResumeAttempts = 3
+	maxVerifyAttempts = 3
+)
+
+var errTransferInterrupted = errors.New("transfer interrupted")
+
+const (
+	DefaultSearchURL   = "https://archive.org/advancedsearch.php"
+	DefaultScrapeURL   = "https://archive.org/services/search/v1/scrape"
+	DefaultMetadataURL = "https://archive.org/metadata"
+	DefaultDownloadURL = "https://archive.org/download"
+	DefaultS3URL       = "https://s3.us.archive.org"
+)
+
+type (
+	Client struct {
+		HTTPClient  *resty.Client
+		apiKey      string
+		searchURL   string
+		scrapeURL   string
+		metadataURL string
+		downloadURL string
+		s3URL       string
+		partSize    int64
+		licenses    LicensePolicy
+		retry       RetryPolicy
+		limiter     *RateLimiter
+	}
+	Option       func(*Client)
+	ProgressFunc func(written, total int64)
+)
+
+func NewClient(apiKey string, opts ...Option) *Client {
+	c := &Client{
+		HTTPClient:  resty.New(),
+		apiKey:      apiKey,
+		searchURL:   DefaultSearchURL,
+		scrapeURL:   DefaultScrapeURL,
+		metadataURL: DefaultMetadataURL,
+		downloadURL: DefaultDownloadURL,
+		s3URL:       DefaultS3URL,
+		partSize:    DefaultUploadPartSize,
+		licenses:    DefaultLicensePolicy(),
+		retry:       DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-func NewClient(apiKey string) *Client {
-	return &Client{
-		HTTPClient: resty.New(),
-		apiKey:     apiKey,
+func WithSearchURL(url string) Option {
+	return func(c *Client) {
+		if url != "" {
+			c.searchURL = url
+		}
 	}
 }
 
-func (c *Client) Search(query string, maxResults int) (*SearchAPIResponse, error) {
-	fullQuery := fmt.Sprintf("mediatype:audio AND (licenseurl:*creative* OR licenseurl:*publicdomain*) AND %s", query)
+func WithScrapeURL(url string) Option {
+	return func(c *Client) {
+		if url != "" {
+			c.scrapeURL = url
+		}
+	}
+}
 
-	var result SearchAPIResponse
-	resp, err := c.HTTPClient.R().
-		SetQueryParams(map[string]string{
-			"q":      fullQuery,
-			"output": "json",
-			"rows":   fmt.Sprintf("%d", maxResults),
-		}).
-		SetQueryParamsFromValues(map[string][]string{
-			"fl[]": {"identifier", "title", "creator", "date", "description", "licenseurl"},
-		}).
-		SetResult(&result).
-		Get("https://archive.org/advancedsearch.php")
+func WithMetadataURL(url string) Option {
+	return func(c *Client) {
+		if url != "" {
+			c.metadataURL = strings.TrimSuffix(url, "/")
+		}
+	}
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("search request failed: %w", err)
+func WithDownloadURL(url string) Option {
+	return func(c *Client) {
+		if url != "" {
+			c.downloadURL = strings.TrimSuffix(url, "/")
+		}
+	}
+}
+
+func WithS3URL(url string) Option {
+	return func(c *Client) {
+		if url != "" {
+			c.s3URL = strings.TrimSuffix(url, "/")
+		}
 	}
+}
 
-	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("search request failed with status %d", resp.StatusCode())
+func WithLicensePolicy(policy LicensePolicy) Option {
+	return func(c *Client) {
+		if len(policy.Allowed) > 0 {
+			c.licenses = policy
+		}
+	}
+}
+
+func WithHTTPClient(httpClient *resty.Client) Option {
+	return func(c *Client) {
+		if httpClient != nil {
+			c.HTTPClient = httpClient
+		}
+	}
+}
+
+func (c *Client) LicensePolicy() LicensePolicy {
+	return c.licenses
+}
+
+func (c *Client) HasCredentials() bool {
+	return c.apiKey != ""
+}
+
+// request starts a request carrying the IA-S3 "LOW access:secret"
+// authorization when the client has credentials.
+func (c *Client) request(ctx context.Context) *resty.Request {
+	req := c.HTTPClient.R().SetContext(ctx)
+	if c.apiKey != "" {
+		req.SetHeader("Authorization", "LOW "+c.apiKey)
+	}
+	return req
+}
+
+// CheckCredentials asks the IA-S3 endpoint whether the configured keys are
+// valid. It returns ErrNoCredentials when the client has none.
+func (c *Client) CheckCredentials(ctx context.Context) (*CredentialsResponse, error) {
+	if !c.HasCredentials() {
+		return nil, ErrNoCredentials
+	}
+
+	var result CredentialsResponse
+	_, err := c.execute(ctx, "credentials check", true, func() (*resty.Response, error) {
+		return c.request(ctx).
+			SetQueryParam("check_auth", "1").
+			SetResult(&result).
+			Get(c.s3URL + "/")
+	})
+	if errors.Is(err, ErrUnauthorized) {
+		return &CredentialsResponse{Authorized: false}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return &result, nil
 }
 
 func (c *Client) GetMetadata(identifier string) (*MetadataResponse, error) {
-	var result MetadataResponse
-	resp, err := c.HTTPClient.R().
-		SetResult(&result).
-		Get(fmt.Sprintf("https://archive.org/metadata/%s", identifier))
+	return c.GetMetadataContext(context.Background(), identifier)
+}
 
+// GetMetadataContext fetches an item's metadata. The metadata API answers 200
+// even for identifiers it does not know, so an empty response is reported as
+// ErrNotFound and a dark item as ErrItemDark. Restricted items return their
+// metadata together with ErrItemRestricted, since it is still public.
+func (c *Client) GetMetadataContext(ctx context.Context, identifier string) (*MetadataResponse, error) {
+	if err := ValidateIdentifier(identifier); err != nil {
+		return nil, err
+	}
+
+	var result MetadataResponse
+	_, err := c.execute(ctx, "metadata request", true, func() (*resty.Response, error) {
+		return c.request(ctx).
+			SetResult(&result).
+			Get(fmt.Sprintf("%s/%s", c.metadataURL, identifier))
+	})
 	if err != nil {
-		return nil, fmt.Errorf("metadata request failed: %w", err)
+		return nil, err
 	}
 
-	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("metadata request failed with status %d", resp.StatusCode())
+	switch {
+	case result.IsDark:
+		return nil, &ItemError{Identifier: identifier, Err: ErrItemDark}
+	case result.Metadata.Identifier == "" && len(result.Files) == 0:
+		return nil, &ItemError{Identifier: identifier, Err: ErrNotFound}
+	case result.Metadata.restricted():
+		return &result, &ItemError{Identifier: identifier, Err: ErrItemRestricted}
 	}
 
 	return &result, nil
 }
 
+func (m ItemMetadata) restricted() bool {
+	return strings.EqualFold(m.AccessRestrictedItem, "true")
+}
+
 func (c *Client) DownloadFile(identifier, filename, destPath string) error {
-	resp, err := c.HTTPClient.R().
-		SetDoNotParseResponse(true).
-		Get(fmt.Sprintf("https://archive.org/download/%s/%s", identifier, filename))
+	return c.DownloadFileContext(context.Background(), identifier, filename, destPath)
+}
+
+func (c *Client) DownloadFileContext(ctx context.Context, identifier, filename, destPath string) error {
+	return c.DownloadContext(ctx, identifier, FileInfo{Name: filename}, destPath, nil)
+}
+
+func (c *Client) DownloadContext(ctx context.Context, identifier string, file FileInfo, destPath string, progress ProgressFunc) error {
+	if err := ValidateIdentifier(identifier); err != nil {
+		return err
+	}
+
+	partPath := PartialPath(destPath)
+	verifier := NewVerifier(file)
+
+	var err error
+	for attempt := 0; attempt < maxVerifyAttempts; attempt++ {
+		if err = c.downloadResumable(ctx, identifier, file, partPath, verifier, progress); err != nil {
+			return err
+		}
+		if err = verifier.Verify(); err == nil {
+			break
+		}
+
+		// A corrupted transfer is discarded and fetched again from scratch.
+		_ = os.Remove(partPath)
+		verifier.Reset()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("download cancelled: %w", errors.Join(ctxErr, err))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("download failed verification after %d attempts: %w", maxVerifyAttempts, err)
+	}
+
+	if err := os.Rename(partPath, destPath); err != nil {
+		return fmt.Errorf("failed to move completed download into place: %w", err)
+	}
+
+	return nil
+}
+
+// downloadResumable fetches file into partPath, resuming interrupted
+// transfers, and feeds every byte of the result to verifier.
+func (c *Client) downloadResumable(ctx context.Context, identifier string, file FileInfo, partPath string, verifier *Verifier, progress ProgressFunc) error {
+	expectedSize := file.SizeBytes()
+
+	var lastErr error
+	for attempt := 0; attempt < maxResumeAttempts; attempt++ {
+		offset, err := partialSize(partPath)
+		if err != nil {
+			return err
+		}
+		if expectedSize > 0 && offset > expectedSize {
+			if err := os.Remove(partPath); err != nil {
+				return fmt.Errorf("failed to discard oversized partial file: %w", err)
+			}
+			offset = 0
+		}
+		if expectedSize > 0 && offset == expectedSize {
+			return verifier.catchUp(partPath, offset)
+		}
 
+		lastErr = c.downloadRange(ctx, identifier, file.Name, partPath, offset, expectedSize, verifier, progress)
+		if lastErr == nil {
+			return nil
+		}
+		// The partial file is kept so a later download resumes it; callers
+		// discard it with PartialPath when the download is given up for good.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("download cancelled: %w", errors.Join(ctxErr, lastErr))
+		}
+		if !errors.Is(lastErr, errTransferInterrupted) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+func (c *Client) downloadRange(ctx context.Context, identifier, filename, partPath string, offset, total int64, verifier *Verifier, progress ProgressFunc) error {
+	resp, err := c.execute(ctx, "download", true, func() (*resty.Response, error) {
+		req := c.request(ctx).
+			SetDoNotParseResponse(true)
+		if offset > 0 {
+			req.SetHeader("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		return req.Get(fmt.Sprintf("%s/%s/%s", c.downloadURL, identifier, escapeFilePath(filename)))
+	}, http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable)
 	if err != nil {
-		return fmt.Errorf("download request failed: %w", err)
+		return err
 	}
 	defer func(resp *resty.Response) { _ = resp.RawBody().Close() }(resp)
-	if resp.StatusCode() != 200 {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode())
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+		verifier.Reset()
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header().Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("download resumed at unexpected range %q", resp.Header().Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+		if err := verifier.catchUp(partPath, offset); err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset > 0 {
+			return verifier.catchUp(partPath, offset)
+		}
+		return &StatusError{Op: "download", StatusCode: resp.StatusCode()}
 	}
 
-	out, err := os.Create(destPath)
+	out, err := os.OpenFile(partPath, flags, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer func(out *os.File) { _ = out.Close() }(out)
 
-	if _, err := io.Copy(out, resp.RawBody()); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	if total <= 0 && resp.RawResponse.ContentLength > 0 {
+		total = offset + resp.RawResponse.ContentLength
+	}
+
+	var dst io.Writer = out
+	if progress != nil {
+		progress(offset, total)
+		dst = &progressWriter{w: out, written: offset, total: total, progress: progress}
+	}
+	dst = io.MultiWriter(dst, verifier)
+
+	if _, err := io.Copy(dst, resp.RawBody()); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("%w: %w", errTransferInterrupted, err)
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
 	}
 
 	return nil
 }
+
+// PartialPath is where DownloadContext keeps an unfinished download of
+// destPath until it is complete and verified.
+func PartialPath(destPath string) string {
+	return destPath + partSuffix
+}
+
+func partialSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to inspect partial file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.progress(p.written, p.total)
+	return n, err
+}
@@ -1,9 +1,20 @@
 package archive
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestClientSearch(t *testing.T) {
@@ -77,3 +88,273 @@ func TestClientDownloadFile(t *testing.T) {
 
 	t.Logf("Downloaded file size: %d bytes", info.Size())
 }
+
+func TestClientCustomBaseURLs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"response":{"numFound":1,"start":0,"docs":[{"identifier":"fake-item"}]}}`))
+	})
+	mux.HandleFunc("/meta/fake-item", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"files":[{"name":"a.mp3","format":"VBR MP3"}],"metadata":{"identifier":"fake-item"}}`))
+	})
+	mux.HandleFunc("/dl/fake-item/a.mp3", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("audio"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient("",
+		WithSearchURL(server.URL+"/search"),
+		WithMetadataURL(server.URL+"/meta/"),
+		WithDownloadURL(server.URL+"/dl"),
+	)
+
+	search, err := client.Search("anything", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(search.Response.Docs) != 1 || search.Response.Docs[0].Identifier != "fake-item" {
+		t.Errorf("Unexpected search docs: %+v", search.Response.Docs)
+	}
+
+	metadata, err := client.GetMetadata("fake-item")
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if metadata.Metadata.Identifier != "fake-item" {
+		t.Errorf("Expected identifier 'fake-item', got '%s'", metadata.Metadata.Identifier)
+	}
+
+	destPath := filepath.Join(t.TempDir(), "a.mp3")
+	if err := client.DownloadFile("fake-item", "a.mp3", destPath); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	data, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatalf("Downloaded file not found: %v", err)
+	}
+	if string(data) != "audio" {
+		t.Errorf("Expected 'audio', got '%s'", string(data))
+	}
+}
+
+func TestClientDownloadFileContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient("", WithDownloadURL(server.URL))
+	destPath := filepath.Join(t.TempDir(), "big.flac")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if err := client.DownloadFileContext(ctx, "big-item", "big.flac", destPath); err == nil {
+		t.Fatal("Expected error from cancelled download")
+	}
+
+	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no file at the destination, stat returned: %v", err)
+	}
+	if partial, err := os.ReadFile(PartialPath(destPath)); err != nil || string(partial) != "partial" {
+		t.Errorf("Expected the partial file to be kept for resuming, got %q: %v", partial, err)
+	}
+}
+
+func TestClientDownloadResumesAfterInterrupt(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		if r.Header.Get("Range") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:10])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 10-%d/%d", len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[10:])
+	}))
+	defer server.Close()
+
+	client := NewClient("", WithDownloadURL(server.URL))
+	destPath := filepath.Join(t.TempDir(), "track.mp3")
+	file := FileInfo{Name: "track.mp3", Size: strconv.Itoa(len(content))}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := client.DownloadContext(ctx, "item", file, destPath, nil); err == nil {
+		t.Fatal("Expected error from interrupted download")
+	}
+	if partial, err := os.ReadFile(PartialPath(destPath)); err != nil || !bytes.Equal(partial, content[:10]) {
+		t.Fatalf("Expected the partial file to be kept, got %q: %v", partial, err)
+	}
+
+	if err := client.DownloadContext(context.Background(), "item", file, destPath, nil); err != nil {
+		t.Fatalf("DownloadContext failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ranges) != 2 || ranges[1] != "bytes=10-" {
+		t.Errorf("Expected the second request to resume with Range 'bytes=10-', got %q", ranges)
+	}
+	if data, err := os.ReadFile(destPath); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Expected resumed content %q, got %q: %v", content, data, err)
+	}
+}
+
+func TestClientDownloadResumesPartialFile(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	var rangeHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader = r.Header.Get("Range")
+		http.ServeContent(w, r, "track.flac", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(destPath+".part", content[:10], 0644); err != nil {
+		t.Fatalf("Failed to seed partial file: %v", err)
+	}
+
+	sum := md5.Sum(content)
+	file := FileInfo{
+		Name: "track.flac",
+		Size: fmt.Sprintf("%d", len(content)),
+		MD5:  hex.EncodeToString(sum[:]),
+	}
+
+	var lastWritten, lastTotal int64
+	progress := func(written, total int64) {
+		lastWritten, lastTotal = written, total
+	}
+
+	client := NewClient("", WithDownloadURL(server.URL))
+	if err := client.DownloadContext(context.Background(), "item", file, destPath, progress); err != nil {
+		t.Fatalf("DownloadContext failed: %v", err)
+	}
+
+	if lastWritten != int64(len(content)) || lastTotal != int64(len(content)) {
+		t.Errorf("Expected final progress %d/%d, got %d/%d", len(content), len(content), lastWritten, lastTotal)
+	}
+
+	if rangeHeader != "bytes=10-" {
+		t.Errorf("Expected Range 'bytes=10-', got '%s'", rangeHeader)
+	}
+
+	data, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatalf("Downloaded file not found: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("Expected resumed content %q, got %q", content, data)
+	}
+
+	if _, err := os.Stat(destPath + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Expected .part file to be renamed away, stat returned: %v", err)
+	}
+}
+
+func TestClientDownloadChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("corrupted"))
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "track.mp3")
+	file := FileInfo{Name: "track.mp3", SHA1: "0000000000000000000000000000000000000000"}
+
+	client := NewClient("", WithDownloadURL(server.URL))
+	err := client.DownloadContext(context.Background(), "item", file, destPath, nil)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+
+	for _, path := range []string{destPath, destPath + ".part"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be absent, stat returned: %v", path, err)
+		}
+	}
+}
+
+func TestClientSendsCredentials(t *testing.T) {
+	var mu sync.Mutex
+	headers := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/metadata/private-item":
+			_, _ = w.Write([]byte(`{"metadata":{"identifier":"private-item"},"files":[{"name":"a.mp3","private":"true"}]}`))
+		case "/s3/":
+			_, _ = w.Write([]byte(`{"authorized":true,"accesskey":"access","username":"user@example.org"}`))
+		default:
+			_, _ = w.Write([]byte("audio"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("access:secret",
+		WithMetadataURL(server.URL+"/metadata"),
+		WithDownloadURL(server.URL+"/download"),
+		WithS3URL(server.URL+"/s3"),
+	)
+
+	result, err := client.GetMetadata("private-item")
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if !result.Files[0].RequiresAuth() {
+		t.Error("Expected private file to require authentication")
+	}
+
+	if err := client.DownloadFile("private-item", "a.mp3", filepath.Join(t.TempDir(), "a.mp3")); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+
+	status, err := client.CheckCredentials(context.Background())
+	if err != nil {
+		t.Fatalf("CheckCredentials failed: %v", err)
+	}
+	if !status.Authorized || status.Username != "user@example.org" {
+		t.Errorf("Unexpected credentials status: %+v", status)
+	}
+
+	for _, path := range []string{"/metadata/private-item", "/download/private-item/a.mp3", "/s3/"} {
+		if headers[path] != "LOW access:secret" {
+			t.Errorf("Expected LOW authorization on %s, got %q", path, headers[path])
+		}
+	}
+
+	anonymous := NewClient("", WithMetadataURL(server.URL+"/metadata"))
+	if _, err := anonymous.GetMetadata("private-item"); err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if headers["/metadata/private-item"] != "" {
+		t.Errorf("Expected no authorization without credentials, got %q", headers["/metadata/private-item"])
+	}
+	if _, err := anonymous.CheckCredentials(context.Background()); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("not found on archive.org")
+	ErrRateLimited   = errors.New("rate limited by archive.org")
+	ErrUnavailable   = errors.New("archive.org is unavailable")
+	ErrUnauthorized  = errors.New("archive.org requires authorization")
+	ErrNoCredentials = errors.New("no archive.org credentials configured")
+
+	ErrItemDark       = errors.New("item is dark and has been withdrawn from public access")
+	ErrItemRestricted = errors.New("item is access-restricted")
+)
+
+type (
+	StatusError struct {
+		Op         string
+		StatusCode int
+		RetryAfter time.Duration
+	}
+	// ItemError reports an item the metadata API answered for but that cannot
+	// be used: unknown (ErrNotFound), dark or restricted.
+	ItemError struct {
+		Identifier string
+		Err        error
+	}
+)
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s failed with status %d", e.Op, e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone:
+		return ErrNotFound
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Identifier, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,68 @@
+package archive
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var audioFormats = []AudioFormat{FLAC, Wave, MP3, OGG}
+
+// SizeBytes returns the file size, or 0 when archive.org did not report one.
+func (f FileInfo) SizeBytes() int64 {
+	size, err := strconv.ParseInt(strings.TrimSpace(f.Size), 10, 64)
+	if err != nil || size < 0 {
+		return 0
+	}
+	return size
+}
+
+// Duration parses Length, which archive.org reports as seconds ("205.34")
+// or as a clock ("3:25", "1:02:03", "03:25.50"). It returns 0 when the
+// length is missing or unreadable.
+func (f FileInfo) Duration() time.Duration {
+	length := strings.TrimSpace(f.Length)
+	if length == "" {
+		return 0
+	}
+
+	var seconds float64
+	for _, part := range strings.Split(length, ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+			return 0
+		}
+		seconds = seconds*60 + value
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
+
+func (f FileInfo) IsOriginal() bool {
+	return f.Source == "original"
+}
+
+func (f FileInfo) IsDerivative() bool {
+	return f.Source == "derivative"
+}
+
+// AudioFormat returns the audio format the file's Format matches, if any.
+func (f FileInfo) AudioFormat() (AudioFormat, bool) {
+	for _, format := range audioFormats {
+		if format.Matches(f.Format) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// OriginalName returns the file this one was derived from, if any.
+func (f FileInfo) OriginalName() string {
+	return originalName(f)
+}
+
+// RequiresAuth reports whether archive.org only serves the file to logged-in
+// accounts.
+func (f FileInfo) RequiresAuth() bool {
+	return strings.EqualFold(f.Private, "true")
+}
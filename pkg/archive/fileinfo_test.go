@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileInfoDuration(t *testing.T) {
+	tests := []struct {
+		length   string
+		expected time.Duration
+	}{
+		{"205.34", 205340 * time.Millisecond},
+		{"3:25", 205 * time.Second},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"03:25.50", 205500 * time.Millisecond},
+		{" 42 ", 42 * time.Second},
+		{"", 0},
+		{"bad", 0},
+		{"1::2", 0},
+		{"-5", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.length, func(t *testing.T) {
+			if got := (FileInfo{Length: tt.length}).Duration(); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFileInfoSizeBytes(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+	}{
+		{"1048576", 1048576},
+		{"0", 0},
+		{"", 0},
+		{"12.5", 0},
+		{"-1", 0},
+	}
+
+	for _, tt := range tests {
+		if got := (FileInfo{Size: tt.size}).SizeBytes(); got != tt.expected {
+			t.Errorf("Size %q: expected %d, got %d", tt.size, tt.expected, got)
+		}
+	}
+}
+
+func TestFileInfoAudioFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected AudioFormat
+		ok       bool
+	}{
+		{"Flac", FLAC, true},
+		{"24bit Flac", FLAC, true},
+		{"VBR MP3", MP3, true},
+		{"Ogg Vorbis", OGG, true},
+		{"WAVE", Wave, true},
+		{"Metadata", "", false},
+		{"JPEG Thumb", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := (FileInfo{Format: tt.format}).AudioFormat()
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("Format %q: expected %q/%v, got %q/%v", tt.format, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestFileInfoSource(t *testing.T) {
+	original := FileInfo{Name: "a.flac", Source: "original"}
+	derivative := FileInfo{Name: "a.mp3", Source: "derivative", Original: "a.flac"}
+
+	if !original.IsOriginal() || original.IsDerivative() {
+		t.Errorf("Expected %s to be an original", original.Name)
+	}
+	if derivative.IsOriginal() || !derivative.IsDerivative() || derivative.OriginalName() != "a.flac" {
+		t.Errorf("Expected %s to derive from a.flac, got %q", derivative.Name, derivative.OriginalName())
+	}
+}
@@ -0,0 +1,33 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidIdentifier = errors.New("invalid identifier")
+
+	identifierPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,99}$`)
+)
+
+// ValidateIdentifier checks an item identifier against the archive.org
+// grammar: up to 100 ASCII letters, digits, underscores, dashes and periods,
+// starting with a letter or digit.
+func ValidateIdentifier(identifier string) error {
+	if !identifierPattern.MatchString(identifier) {
+		return fmt.Errorf("%w: %q must be 1-100 letters, digits, '_', '-' or '.', starting with a letter or digit", ErrInvalidIdentifier, identifier)
+	}
+	return nil
+}
+
+func escapeFilePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,30 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateIdentifier(t *testing.T) {
+	valid := []string{"Greatest_Speeches_of_the_20th_Century", "OTRR_Dragnet_Singles", "gd1977-05-08.sbd.hicks.4982.sbeok.shnf", "78_jazz-me-blues"}
+	for _, identifier := range valid {
+		if err := ValidateIdentifier(identifier); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", identifier, err)
+		}
+	}
+
+	invalid := []string{"", "../../etc", "item/../other", ".hidden", "-leading-dash", "has space", "semi;colon", string(make([]byte, 101))}
+	for _, identifier := range invalid {
+		if err := ValidateIdentifier(identifier); !errors.Is(err, ErrInvalidIdentifier) {
+			t.Errorf("Expected %q to be invalid, got %v", identifier, err)
+		}
+	}
+}
+
+func TestEscapeFilePath(t *testing.T) {
+	got := escapeFilePath("Disc 1/01 - Overture #1?.mp3")
+	want := "Disc%201/01%20-%20Overture%20%231%3F.mp3"
+	if got != want {
+		t.Errorf("escapeFilePath() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type License string
+
+const (
+	CCBY             License = "by"
+	CCBYSA           License = "by-sa"
+	CCBYND           License = "by-nd"
+	CCBYNC           License = "by-nc"
+	CCBYNCSA         License = "by-nc-sa"
+	CCBYNCND         License = "by-nc-nd"
+	CC0              License = "cc0"
+	PublicDomainMark License = "pdm"
+	UnknownLicense   License = "unknown"
+	OtherLicense     License = "other"
+)
+
+var (
+	ErrLicenseNotAllowed = errors.New("license not allowed by policy")
+
+	knownLicenses = []License{CCBY, CCBYSA, CCBYND, CCBYNC, CCBYNCSA, CCBYNCND, CC0, PublicDomainMark, UnknownLicense}
+	ccLicensePath = regexp.MustCompile(`creativecommons\.org/licenses/([a-z-]+)`)
+)
+
+type LicensePolicy struct {
+	Allowed []License
+}
+
+// DefaultLicensePolicy allows every Creative Commons variant and public domain
+// dedication, matching what the search used to accept before policies were
+// configurable.
+func DefaultLicensePolicy() LicensePolicy {
+	return LicensePolicy{Allowed: []License{CCBY, CCBYSA, CCBYND, CCBYNC, CCBYNCSA, CCBYNCND, CC0, PublicDomainMark}}
+}
+
+func ParseLicensePolicy(names []string) (LicensePolicy, error) {
+	var policy LicensePolicy
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		license, err := ParseLicense(name)
+		if err != nil {
+			return LicensePolicy{}, err
+		}
+		policy.Allowed = append(policy.Allowed, license)
+	}
+	if len(policy.Allowed) == 0 {
+		return LicensePolicy{}, fmt.Errorf("license policy must allow at least one license")
+	}
+	return policy, nil
+}
+
+func ParseLicense(name string) (License, error) {
+	for _, license := range knownLicenses {
+		if string(license) == name {
+			return license, nil
+		}
+	}
+	return "", fmt.Errorf("unknown license %q", name)
+}
+
+// ClassifyLicense works out which license an item is published under from its
+// licenseurl, falling back to the copyright status and rights fields some
+// public domain items use instead.
+func ClassifyLicense(meta ItemMetadata) License {
+	licenseURL := strings.ToLower(strings.TrimSpace(meta.LicenseURL.First()))
+	switch {
+	case strings.Contains(licenseURL, "creativecommons.org/publicdomain/zero"):
+		return CC0
+	case strings.Contains(licenseURL, "creativecommons.org/publicdomain/mark"),
+		strings.Contains(licenseURL, "creativecommons.org/licenses/publicdomain"):
+		return PublicDomainMark
+	case licenseURL != "":
+		if matches := ccLicensePath.FindStringSubmatch(licenseURL); matches != nil {
+			for _, license := range knownLicenses {
+				if string(license) == matches[1] {
+					return license
+				}
+			}
+		}
+		return OtherLicense
+	}
+
+	if meta.PossibleCopyrightStatus.Contains("NOT_IN_COPYRIGHT") ||
+		strings.Contains(strings.ToLower(meta.Rights.String()), "public domain") {
+		return PublicDomainMark
+	}
+
+	return UnknownLicense
+}
+
+func (p LicensePolicy) Allows(license License) bool {
+	for _, allowed := range p.Allowed {
+		if allowed == license {
+			return true
+		}
+	}
+	return false
+}
+
+func (p LicensePolicy) Check(meta ItemMetadata) error {
+	license := ClassifyLicense(meta)
+	if !p.Allows(license) {
+		if len(meta.LicenseURL) > 0 {
+			return fmt.Errorf("%w: %s is published under %s (%s)", ErrLicenseNotAllowed, meta.Identifier, license, meta.LicenseURL)
+		}
+		return fmt.Errorf("%w: %s is published under %s", ErrLicenseNotAllowed, meta.Identifier, license)
+	}
+	return nil
+}
+
+// Clause renders the policy as a Lucene expression restricting search results
+// to the allowed licenses.
+func (p LicensePolicy) Clause() string {
+	var terms []string
+	for _, license := range p.Allowed {
+		switch license {
+		case CC0:
+			terms = append(terms, `licenseurl:*publicdomain\/zero*`)
+		case PublicDomainMark:
+			terms = append(terms,
+				`licenseurl:*publicdomain\/mark*`,
+				`licenseurl:*licenses\/publicdomain*`,
+				`possible-copyright-status:NOT_IN_COPYRIGHT`,
+			)
+		case UnknownLicense:
+			terms = append(terms, `(*:* -licenseurl:[* TO *])`)
+		default:
+			terms = append(terms, fmt.Sprintf(`licenseurl:*licenses\/%s\/*`, license))
+		}
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
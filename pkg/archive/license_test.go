@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClassifyLicense(t *testing.T) {
+	tests := []struct {
+		name string
+		meta ItemMetadata
+		want License
+	}{
+		{"attribution", ItemMetadata{LicenseURL: StringOrSlice{"http://creativecommons.org/licenses/by/3.0/"}}, CCBY},
+		{"non-commercial share-alike", ItemMetadata{LicenseURL: StringOrSlice{"https://creativecommons.org/licenses/by-nc-sa/4.0/"}}, CCBYNCSA},
+		{"no derivatives", ItemMetadata{LicenseURL: StringOrSlice{"http://creativecommons.org/licenses/by-nd/2.5/"}}, CCBYND},
+		{"cc0", ItemMetadata{LicenseURL: StringOrSlice{"http://creativecommons.org/publicdomain/zero/1.0/"}}, CC0},
+		{"public domain mark", ItemMetadata{LicenseURL: StringOrSlice{"http://creativecommons.org/publicdomain/mark/1.0/"}}, PublicDomainMark},
+		{"legacy public domain", ItemMetadata{LicenseURL: StringOrSlice{"http://creativecommons.org/licenses/publicdomain/"}}, PublicDomainMark},
+		{"copyright status", ItemMetadata{PossibleCopyrightStatus: StringOrSlice{"NOT_IN_COPYRIGHT"}}, PublicDomainMark},
+		{"rights statement", ItemMetadata{Rights: StringOrSlice{"This recording is in the Public Domain."}}, PublicDomainMark},
+		{"sampling license", ItemMetadata{LicenseURL: StringOrSlice{"http://creativecommons.org/licenses/sampling+/1.0/"}}, OtherLicense},
+		{"no license", ItemMetadata{}, UnknownLicense},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyLicense(tt.meta); got != tt.want {
+				t.Errorf("ClassifyLicense() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLicensePolicyCheck(t *testing.T) {
+	policy, err := ParseLicensePolicy([]string{"by", "BY-SA", "cc0", "pdm"})
+	if err != nil {
+		t.Fatalf("ParseLicensePolicy failed: %v", err)
+	}
+
+	if err := policy.Check(ItemMetadata{LicenseURL: StringOrSlice{"http://creativecommons.org/licenses/by-sa/3.0/"}}); err != nil {
+		t.Errorf("Expected by-sa to be allowed, got %v", err)
+	}
+
+	err = policy.Check(ItemMetadata{Identifier: "nc-item", LicenseURL: StringOrSlice{"http://creativecommons.org/licenses/by-nc/3.0/"}})
+	if !errors.Is(err, ErrLicenseNotAllowed) {
+		t.Errorf("Expected ErrLicenseNotAllowed for by-nc, got %v", err)
+	}
+
+	if err := policy.Check(ItemMetadata{}); !errors.Is(err, ErrLicenseNotAllowed) {
+		t.Errorf("Expected unknown license to be rejected, got %v", err)
+	}
+
+	if _, err := ParseLicensePolicy([]string{"gpl"}); err == nil {
+		t.Error("Expected error for unsupported license")
+	}
+	if _, err := ParseLicensePolicy(nil); err == nil {
+		t.Error("Expected error for empty policy")
+	}
+}
+
+func TestLicensePolicyClause(t *testing.T) {
+	policy := LicensePolicy{Allowed: []License{CCBY, PublicDomainMark, UnknownLicense}}
+	clause := policy.Clause()
+
+	for _, want := range []string{
+		`licenseurl:*licenses\/by\/*`,
+		`possible-copyright-status:NOT_IN_COPYRIGHT`,
+		`(*:* -licenseurl:[* TO *])`,
+	} {
+		if !strings.Contains(clause, want) {
+			t.Errorf("Expected clause to contain %q, got %q", want, clause)
+		}
+	}
+	if strings.Contains(clause, "by-nc") {
+		t.Errorf("Expected clause without non-commercial licenses, got %q", clause)
+	}
+}
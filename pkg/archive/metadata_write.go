@@ -0,0 +1,214 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const MetadataTarget = "metadata"
+
+var (
+	ErrNoMetadataChanges     = errors.New("no metadata changes")
+	ErrMetadataWriteRejected = errors.New("archive.org rejected the metadata change")
+)
+
+type (
+	// PatchOperation is a single RFC 6902 JSON Patch operation.
+	PatchOperation struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value,omitempty"`
+	}
+	// MetadataChange patches one target of an item: MetadataTarget for the
+	// item metadata or FileTarget(name) for a file's.
+	MetadataChange struct {
+		Target string           `json:"target"`
+		Patch  []PatchOperation `json:"patch"`
+	}
+	// MetadataUpdate lists fields to set and fields to remove. Empty strings
+	// and empty lists in Set also remove the field.
+	MetadataUpdate struct {
+		Set    map[string]any
+		Remove []string
+	}
+	FieldChange struct {
+		Field string `json:"field"`
+		Op    string `json:"op"`
+		Old   any    `json:"old,omitempty"`
+		New   any    `json:"new,omitempty"`
+	}
+	MetadataWriteResponse struct {
+		Success bool   `json:"success"`
+		TaskID  int64  `json:"task_id,omitempty"`
+		Log     string `json:"log,omitempty"`
+		Error   string `json:"error,omitempty"`
+	}
+)
+
+func FileTarget(name string) string {
+	return "files/" + name
+}
+
+// Diff compares the update against current, which may be an ItemMetadata,
+// a FileInfo or any value that marshals to a JSON object, and returns the
+// changes in field order. Fields whose value would not change are left out.
+func (u MetadataUpdate) Diff(current any) ([]FieldChange, error) {
+	existing, err := toJSONObject(current)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]any, len(u.Set)+len(u.Remove))
+	for name, value := range u.Set {
+		fields[name] = value
+	}
+	for _, name := range u.Remove {
+		fields[name] = nil
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []FieldChange
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("metadata field name cannot be empty")
+		}
+		value, err := normalizeJSON(fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		old, exists := existing[name]
+
+		switch {
+		case isEmptyValue(value) && exists:
+			changes = append(changes, FieldChange{Field: name, Op: "remove", Old: old})
+		case isEmptyValue(value):
+		case !exists:
+			changes = append(changes, FieldChange{Field: name, Op: "add", New: value})
+		case !reflect.DeepEqual(old, value):
+			changes = append(changes, FieldChange{Field: name, Op: "replace", Old: old, New: value})
+		}
+	}
+	return changes, nil
+}
+
+// Patch turns changes into JSON Patch operations.
+func Patch(changes []FieldChange) []PatchOperation {
+	patch := make([]PatchOperation, 0, len(changes))
+	for _, change := range changes {
+		patch = append(patch, PatchOperation{Op: change.Op, Path: "/" + escapePointer(change.Field), Value: change.New})
+	}
+	return patch
+}
+
+// UpdateMetadata submits JSON Patch changes through the metadata write API.
+// archive.org applies them asynchronously in the task the response names.
+func (c *Client) UpdateMetadata(ctx context.Context, identifier string, changes ...MetadataChange) (*MetadataWriteResponse, error) {
+	if err := ValidateIdentifier(identifier); err != nil {
+		return nil, err
+	}
+	if !c.HasCredentials() {
+		return nil, ErrNoCredentials
+	}
+
+	var nonEmpty []MetadataChange
+	for _, change := range changes {
+		if len(change.Patch) > 0 {
+			nonEmpty = append(nonEmpty, change)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return nil, ErrNoMetadataChanges
+	}
+
+	form := map[string]string{}
+	if len(nonEmpty) == 1 {
+		patch, err := json.Marshal(nonEmpty[0].Patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata patch: %w", err)
+		}
+		form["-target"] = nonEmpty[0].Target
+		form["-patch"] = string(patch)
+	} else {
+		encoded, err := json.Marshal(nonEmpty)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata changes: %w", err)
+		}
+		form["-changes"] = string(encoded)
+	}
+	access, secret, _ := strings.Cut(c.apiKey, ":")
+	form["access"] = access
+	form["secret"] = secret
+
+	var result MetadataWriteResponse
+	_, err := c.execute(ctx, "metadata write", false, func() (*resty.Response, error) {
+		return c.request(ctx).
+			SetFormData(form).
+			SetResult(&result).
+			SetError(&result).
+			Post(fmt.Sprintf("%s/%s", c.metadataURL, identifier))
+	}, http.StatusOK, http.StatusBadRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.Success {
+		return &result, fmt.Errorf("%w: %s", ErrMetadataWriteRejected, result.Error)
+	}
+	return &result, nil
+}
+
+func toJSONObject(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode current metadata: %w", err)
+	}
+	object := map[string]any{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("current metadata is not an object: %w", err)
+	}
+	return object, nil
+}
+
+// normalizeJSON round-trips v so values compare equal to decoded metadata,
+// e.g. []string becomes []any.
+func normalizeJSON(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var normalized any
+	err = json.Unmarshal(data, &normalized)
+	return normalized, err
+}
+
+func isEmptyValue(v any) bool {
+	switch value := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(value) == ""
+	case []any:
+		return len(value) == 0
+	}
+	return false
+}
+
+func escapePointer(field string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(field)
+}
@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataUpdateDiff(t *testing.T) {
+	current := ItemMetadata{
+		Identifier: "curated-item",
+		Title:      StringOrSlice{"Old Title"},
+		Creator:    StringOrSlice{"Someone"},
+		Subject:    StringOrSlice{"radio"},
+	}
+
+	tests := []struct {
+		name   string
+		update MetadataUpdate
+		want   []FieldChange
+	}{
+		{
+			name:   "replace and add",
+			update: MetadataUpdate{Set: map[string]any{"title": "New Title", "language": "eng"}},
+			want: []FieldChange{
+				{Field: "language", Op: "add", New: "eng"},
+				{Field: "title", Op: "replace", Old: "Old Title", New: "New Title"},
+			},
+		},
+		{
+			name:   "unchanged fields are skipped",
+			update: MetadataUpdate{Set: map[string]any{"creator": "Someone"}},
+			want:   nil,
+		},
+		{
+			name:   "remove and clear",
+			update: MetadataUpdate{Set: map[string]any{"subject": ""}, Remove: []string{"creator", "missing"}},
+			want: []FieldChange{
+				{Field: "creator", Op: "remove", Old: "Someone"},
+				{Field: "subject", Op: "remove", Old: "radio"},
+			},
+		},
+		{
+			name:   "lists",
+			update: MetadataUpdate{Set: map[string]any{"subject": []string{"radio", "news"}}},
+			want: []FieldChange{
+				{Field: "subject", Op: "replace", Old: "radio", New: []any{"radio", "news"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.update.Diff(current)
+			if err != nil {
+				t.Fatalf("Diff failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	patch := Patch([]FieldChange{{Field: "a/b", Op: "add", New: "x"}, {Field: "c", Op: "remove"}})
+	want := []PatchOperation{{Op: "add", Path: "/a~1b", Value: "x"}, {Op: "remove", Path: "/c"}}
+	if !reflect.DeepEqual(patch, want) {
+		t.Errorf("Expected patch %+v, got %+v", want, patch)
+	}
+}
+
+func TestClientUpdateMetadata(t *testing.T) {
+	var forms []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form := map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		forms = append(forms, form)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(forms) == 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"success":false,"error":"no changes to _meta.xml"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true,"task_id":42,"log":"https://catalogd.archive.org/log/42"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("access:secret", WithMetadataURL(server.URL))
+	title := MetadataChange{Target: MetadataTarget, Patch: []PatchOperation{{Op: "replace", Path: "/title", Value: "New"}}}
+	file := MetadataChange{Target: FileTarget("a.mp3"), Patch: []PatchOperation{{Op: "add", Path: "/title", Value: "Track A"}}}
+
+	result, err := client.UpdateMetadata(context.Background(), "curated-item", title)
+	if err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+	if result.TaskID != 42 {
+		t.Errorf("Expected task 42, got %d", result.TaskID)
+	}
+	if forms[0]["-target"] != "metadata" || forms[0]["access"] != "access" || forms[0]["secret"] != "secret" {
+		t.Errorf("Unexpected single-target form: %v", forms[0])
+	}
+
+	if _, err := client.UpdateMetadata(context.Background(), "curated-item", title, file); err != nil {
+		t.Fatalf("UpdateMetadata with two targets failed: %v", err)
+	}
+	var changes []MetadataChange
+	if err := json.Unmarshal([]byte(forms[1]["-changes"]), &changes); err != nil || len(changes) != 2 || changes[1].Target != "files/a.mp3" {
+		t.Errorf("Expected -changes for two targets, got %v (%v)", forms[1], err)
+	}
+
+	if _, err := client.UpdateMetadata(context.Background(), "curated-item", title); !errors.Is(err, ErrMetadataWriteRejected) {
+		t.Errorf("Expected ErrMetadataWriteRejected, got %v", err)
+	}
+
+	if _, err := client.UpdateMetadata(context.Background(), "curated-item", MetadataChange{Target: MetadataTarget}); !errors.Is(err, ErrNoMetadataChanges) {
+		t.Errorf("Expected ErrNoMetadataChanges, got %v", err)
+	}
+	if _, err := NewClient("", WithMetadataURL(server.URL)).UpdateMetadata(context.Background(), "curated-item", title); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials, got %v", err)
+	}
+}
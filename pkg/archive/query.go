@@ -0,0 +1,202 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type SortOrder string
+
+const (
+	Ascending  SortOrder = "asc"
+	Descending SortOrder = "desc"
+)
+
+var (
+	ErrEmptyQuery = errors.New("search query has no criteria")
+
+	sortableFields = map[string]bool{
+		"downloads":     true,
+		"date":          true,
+		"publicdate":    true,
+		"addeddate":     true,
+		"titleSorter":   true,
+		"creatorSorter": true,
+		"avg_rating":    true,
+		"num_reviews":   true,
+		"week":          true,
+		"month":         true,
+	}
+	datePattern    = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+	luceneSpecials = strings.NewReplacer(
+		`\`, `\\`, `+`, `\+`, `-`, `\-`, `&`, `\&`, `|`, `\|`, `!`, `\!`,
+		`(`, `\(`, `)`, `\)`, `{`, `\{`, `}`, `\}`, `[`, `\[`, `]`, `\]`,
+		`^`, `\^`, `"`, `\"`, `~`, `\~`, `*`, `\*`, `?`, `\?`, `:`, `\:`, `/`, `\/`,
+	)
+	phraseSpecials  = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	luceneOperators = map[string]bool{"AND": true, "OR": true, "NOT": true}
+)
+
+type (
+	SortField struct {
+		Field string
+		Order SortOrder
+	}
+	// SearchQuery describes an audio search. Text and the field filters are
+	// user input and are escaped; Raw is inserted as-is for callers that
+	// already hold a Lucene expression.
+	SearchQuery struct {
+		Text         string
+		Raw          string
+		Creator      string
+		Collection   string
+		Subject      string
+		Language     string
+		DateFrom     string
+		DateTo       string
+		MinDownloads int
+		MaxDownloads int
+		Sort         []SortField
+	}
+)
+
+func ParseSortField(s string) (SortField, error) {
+	parts := strings.Fields(s)
+	if len(parts) == 0 || len(parts) > 2 {
+		return SortField{}, fmt.Errorf("invalid sort %q, expected \"<field> [asc|desc]\"", s)
+	}
+
+	sort := SortField{Field: parts[0], Order: Descending}
+	if len(parts) == 2 {
+		sort.Order = SortOrder(strings.ToLower(parts[1]))
+	}
+	return sort, sort.validate()
+}
+
+func (s SortField) String() string {
+	return s.Field + " " + string(s.Order)
+}
+
+func (s SortField) validate() error {
+	if !sortableFields[s.Field] {
+		return fmt.Errorf("cannot sort by %q", s.Field)
+	}
+	if s.Order != Ascending && s.Order != Descending {
+		return fmt.Errorf("invalid sort order %q, expected asc or desc", s.Order)
+	}
+	return nil
+}
+
+func (q SearchQuery) Validate() error {
+	if q.String() == "" {
+		return ErrEmptyQuery
+	}
+	for name, value := range map[string]string{"DateFrom": q.DateFrom, "DateTo": q.DateTo} {
+		if value != "" && !datePattern.MatchString(value) {
+			return fmt.Errorf("%s must be YYYY, YYYY-MM or YYYY-MM-DD, got %q", name, value)
+		}
+	}
+	if q.MinDownloads < 0 || q.MaxDownloads < 0 {
+		return fmt.Errorf("download bounds cannot be negative")
+	}
+	if q.MaxDownloads > 0 && q.MinDownloads > q.MaxDownloads {
+		return fmt.Errorf("MinDownloads %d is greater than MaxDownloads %d", q.MinDownloads, q.MaxDownloads)
+	}
+	for _, sort := range q.Sort {
+		if err := sort.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String renders the query criteria as a Lucene expression, without the
+// media type and license restrictions the client adds.
+func (q SearchQuery) String() string {
+	var clauses []string
+
+	if terms := strings.Fields(q.Text); len(terms) > 0 {
+		for i, term := range terms {
+			terms[i] = EscapeTerm(term)
+		}
+		clauses = append(clauses, "("+strings.Join(terms, " ")+")")
+	}
+	if raw := strings.TrimSpace(q.Raw); raw != "" {
+		clauses = append(clauses, "("+raw+")")
+	}
+
+	for _, filter := range []struct{ field, value string }{
+		{"creator", q.Creator},
+		{"collection", q.Collection},
+		{"subject", q.Subject},
+		{"language", q.Language},
+	} {
+		if value := strings.TrimSpace(filter.value); value != "" {
+			clauses = append(clauses, fmt.Sprintf(`%s:"%s"`, filter.field, phraseSpecials.Replace(value)))
+		}
+	}
+
+	if q.DateFrom != "" || q.DateTo != "" {
+		clauses = append(clauses, fmt.Sprintf("date:[%s TO %s]", rangeStart(q.DateFrom), rangeEnd(q.DateTo)))
+	}
+
+	if q.MinDownloads > 0 || q.MaxDownloads > 0 {
+		upper := "*"
+		if q.MaxDownloads > 0 {
+			upper = fmt.Sprintf("%d", q.MaxDownloads)
+		}
+		clauses = append(clauses, fmt.Sprintf("downloads:[%d TO %s]", q.MinDownloads, upper))
+	}
+
+	return strings.Join(clauses, " AND ")
+}
+
+func (q SearchQuery) sortParams() []string {
+	params := make([]string, 0, len(q.Sort))
+	for _, sort := range q.Sort {
+		params = append(params, sort.String())
+	}
+	return params
+}
+
+// EscapeTerm escapes Lucene syntax in a single term and quotes a bare AND, OR
+// or NOT so it is searched for instead of read as an operator.
+func EscapeTerm(term string) string {
+	if luceneOperators[term] {
+		return `"` + term + `"`
+	}
+	return luceneSpecials.Replace(term)
+}
+
+func rangeStart(date string) string {
+	switch len(date) {
+	case 0:
+		return "*"
+	case 4:
+		return date + "-01-01"
+	case 7:
+		return date + "-01"
+	default:
+		return date
+	}
+}
+
+func rangeEnd(date string) string {
+	switch len(date) {
+	case 0:
+		return "*"
+	case 4:
+		return date + "-12-31"
+	case 7:
+		month, err := time.Parse("2006-01", date)
+		if err != nil {
+			return date + "-31"
+		}
+		return month.AddDate(0, 1, -1).Format("2006-01-02")
+	default:
+		return date
+	}
+}
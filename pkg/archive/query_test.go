@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSearchQueryString(t *testing.T) {
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  string
+	}{
+		{
+			name:  "free text",
+			query: SearchQuery{Text: "war of the worlds"},
+			want:  "(war of the worlds)",
+		},
+		{
+			name:  "free text with lucene syntax",
+			query: SearchQuery{Text: `title:"D-Day" (1944)`},
+			want:  `(title\:\"D\-Day\" \(1944\))`,
+		},
+		{
+			name:  "free text with lucene operators",
+			query: SearchQuery{Text: "rock AND roll OR NOT blues and"},
+			want:  `(rock "AND" roll "OR" "NOT" blues and)`,
+		},
+		{
+			name:  "raw expression",
+			query: SearchQuery{Raw: "creator:(Welles)"},
+			want:  "(creator:(Welles))",
+		},
+		{
+			name:  "field filters",
+			query: SearchQuery{Creator: `Orson "The" Welles`, Collection: "oldtimeradio", Language: "English"},
+			want:  `creator:"Orson \"The\" Welles" AND collection:"oldtimeradio" AND language:"English"`,
+		},
+		{
+			name:  "year range",
+			query: SearchQuery{Text: "jazz", DateFrom: "1920", DateTo: "1929"},
+			want:  "(jazz) AND date:[1920-01-01 TO 1929-12-31]",
+		},
+		{
+			name:  "open ended month range",
+			query: SearchQuery{DateTo: "1944-02"},
+			want:  "date:[* TO 1944-02-29]",
+		},
+		{
+			name:  "download bounds",
+			query: SearchQuery{Subject: "speeches", MinDownloads: 100},
+			want:  `subject:"speeches" AND downloads:[100 TO *]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchQueryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   SearchQuery
+		wantErr bool
+	}{
+		{"text only", SearchQuery{Text: "jazz"}, false},
+		{"empty", SearchQuery{}, true},
+		{"bad date", SearchQuery{Text: "jazz", DateFrom: "1920s"}, true},
+		{"inverted downloads", SearchQuery{Text: "jazz", MinDownloads: 10, MaxDownloads: 5}, true},
+		{"unknown sort", SearchQuery{Text: "jazz", Sort: []SortField{{Field: "random", Order: Ascending}}}, true},
+		{"valid sort", SearchQuery{Text: "jazz", Sort: []SortField{{Field: "downloads", Order: Descending}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (SearchQuery{}).Validate(); !errors.Is(err, ErrEmptyQuery) {
+		t.Errorf("Expected ErrEmptyQuery, got %v", err)
+	}
+}
+
+func TestParseSortField(t *testing.T) {
+	sort, err := ParseSortField(" date  ASC ")
+	if err != nil {
+		t.Fatalf("ParseSortField failed: %v", err)
+	}
+	if sort.Field != "date" || sort.Order != Ascending {
+		t.Errorf("Unexpected sort field: %+v", sort)
+	}
+
+	sort, err = ParseSortField("downloads")
+	if err != nil {
+		t.Fatalf("ParseSortField failed: %v", err)
+	}
+	if sort.String() != "downloads desc" {
+		t.Errorf("Expected default descending order, got %q", sort.String())
+	}
+
+	if _, err := ParseSortField("downloads sideways"); err == nil {
+		t.Error("Expected error for invalid order")
+	}
+}
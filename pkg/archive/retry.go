@@ -0,0 +1,198 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type (
+	RetryPolicy struct {
+		MaxRetries int
+		BaseDelay  time.Duration
+		MaxDelay   time.Duration
+	}
+	// RateLimiter is a token bucket shared by every request a Client makes.
+	RateLimiter struct {
+		mu     sync.Mutex
+		rate   float64
+		burst  float64
+		tokens float64
+		last   time.Time
+	}
+)
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxRetries: 4, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+}
+
+// backoff returns a full-jitter exponential delay for the given attempt,
+// starting from zero.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	ceiling := p.BaseDelay << min(attempt, 30)
+	if p.MaxDelay > 0 && (ceiling > p.MaxDelay || ceiling <= 0) {
+		ceiling = p.MaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	b := float64(max(burst, 1))
+	return &RateLimiter{rate: perSecond, burst: b, tokens: b, last: time.Now()}
+}
+
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *Client) {
+		c.limiter = NewRateLimiter(perSecond, burst)
+	}
+}
+
+// execute sends a request built by send, waiting on the rate limiter before
+// every attempt and retrying network errors, 429 and 5xx responses with
+// jittered exponential backoff. A Retry-After header overrides the backoff.
+// Requests that are not idempotent are only retried when they cannot have
+// taken effect: the connection was never made, or the server answered 429
+// or 503. Any status other than those in ok is returned as a *StatusError.
+func (c *Client) execute(ctx context.Context, op string, idempotent bool, send func() (*resty.Response, error), ok ...int) (*resty.Response, error) {
+	if len(ok) == 0 {
+		ok = []int{http.StatusOK}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("%s failed: %w", op, err)
+		}
+
+		resp, err := send()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, fmt.Errorf("%s failed: %w", op, errors.Join(ctxErr, err))
+			}
+			if attempt >= c.retry.MaxRetries || !idempotent && !notSent(err) {
+				return nil, fmt.Errorf("%s failed: %w: %w", op, ErrUnavailable, err)
+			}
+			if err := sleep(ctx, c.retry.backoff(attempt)); err != nil {
+				return nil, fmt.Errorf("%s failed: %w", op, err)
+			}
+			continue
+		}
+
+		for _, code := range ok {
+			if resp.StatusCode() == code {
+				return resp, nil
+			}
+		}
+
+		closeBody(resp)
+		statusErr := &StatusError{Op: op, StatusCode: resp.StatusCode(), RetryAfter: retryAfter(resp)}
+		if !retryable(resp.StatusCode(), idempotent) || attempt >= c.retry.MaxRetries {
+			return nil, statusErr
+		}
+
+		delay := c.retry.backoff(attempt)
+		if statusErr.RetryAfter > 0 {
+			delay = statusErr.RetryAfter
+			if c.retry.MaxDelay > 0 {
+				delay = min(delay, c.retry.MaxDelay)
+			}
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, fmt.Errorf("%s failed: %w", op, err)
+		}
+	}
+}
+
+func retryable(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// notSent reports whether err means the request never left the client,
+// because resolving the host or connecting to it failed.
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) || errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func retryAfter(resp *resty.Response) time.Duration {
+	value := resp.Header().Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+func closeBody(resp *resty.Response) {
+	if body := resp.RawBody(); body != nil {
+		_ = body.Close()
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
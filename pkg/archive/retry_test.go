@@ -0,0 +1,205 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+var testRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestClientRetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"metadata":{"identifier":"retried"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("", WithMetadataURL(server.URL), WithRetryPolicy(testRetryPolicy))
+	result, err := client.GetMetadata("retried")
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+
+	if result.Metadata.Identifier != "retried" {
+		t.Errorf("Expected identifier 'retried', got '%s'", result.Metadata.Identifier)
+	}
+
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 requests, got %d", calls.Load())
+	}
+}
+
+func TestClientTypedErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		want    error
+		retries int32
+	}{
+		{"not found", http.StatusNotFound, ErrNotFound, 1},
+		{"rate limited", http.StatusTooManyRequests, ErrRateLimited, 4},
+		{"unavailable", http.StatusBadGateway, ErrUnavailable, 4},
+		{"forbidden", http.StatusForbidden, nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			client := NewClient("", WithSearchURL(server.URL), WithRetryPolicy(testRetryPolicy))
+			_, err := client.Search("test", 1)
+
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+				t.Fatalf("Expected StatusError with status %d, got %v", tt.status, err)
+			}
+
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+
+			if calls.Load() != tt.retries {
+				t.Errorf("Expected %d requests, got %d", tt.retries, calls.Load())
+			}
+		})
+	}
+}
+
+func TestClientRetriesNonIdempotentRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		calls   int32
+	}{
+		{"rate limited", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTooManyRequests) }, 4},
+		{"unavailable", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) }, 4},
+		{"server error", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, 1},
+		{"bad gateway", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) }, 1},
+		{"connection dropped", func(w http.ResponseWriter, r *http.Request) {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			client := NewClient("", WithRetryPolicy(testRetryPolicy))
+			_, err := client.execute(context.Background(), "write", false, func() (*resty.Response, error) {
+				return client.request(context.Background()).Post(server.URL)
+			})
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if calls.Load() != tt.calls {
+				t.Errorf("Expected %d requests, got %d", tt.calls, calls.Load())
+			}
+		})
+	}
+
+	// A connection that was never made cannot have written anything.
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	var attempts int
+	client := NewClient("", WithRetryPolicy(testRetryPolicy))
+	_, err := client.execute(context.Background(), "write", false, func() (*resty.Response, error) {
+		attempts++
+		return client.request(context.Background()).Post(server.URL)
+	})
+	if !errors.Is(err, ErrUnavailable) || attempts != 4 {
+		t.Errorf("Expected 4 attempts ending in ErrUnavailable, got %d: %v", attempts, err)
+	}
+}
+
+func TestClientHonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	var first time.Time
+	var elapsed time.Duration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		elapsed = time.Since(first)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"metadata":{"identifier":"slow"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("", WithMetadataURL(server.URL), WithRetryPolicy(RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}))
+	if _, err := client.GetMetadata("slow"); err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+
+	if elapsed < time.Second {
+		t.Errorf("Expected retry after at least 1s, got %v", elapsed)
+	}
+}
+
+func TestClientRetryStopsOnCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := NewClient("", WithMetadataURL(server.URL))
+	_, err := client.GetMetadataContext(ctx, "slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(50, 2)
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 4 {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+
+	// Two tokens are available immediately; the other two refill at 50/s.
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected limiter to delay requests, took %v", elapsed)
+	}
+
+	if NewRateLimiter(0, 1) != nil {
+		t.Error("Expected a zero rate to disable the limiter")
+	}
+
+	var disabled *RateLimiter
+	if err := disabled.Wait(ctx); err != nil {
+		t.Errorf("Expected nil limiter to never block, got %v", err)
+	}
+}
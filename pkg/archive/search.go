@@ -0,0 +1,97 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	minScrapeCount = 100
+	maxScrapeCount = 10000
+)
+
+var searchFields = []string{"identifier", "title", "creator", "date", "year", "description", "subject", "collection", "language", "licenseurl"}
+
+func (c *Client) Search(query string, maxResults int) (*SearchAPIResponse, error) {
+	return c.SearchContext(context.Background(), query, maxResults)
+}
+
+func (c *Client) SearchContext(ctx context.Context, query string, maxResults int) (*SearchAPIResponse, error) {
+	return c.SearchPageContext(ctx, SearchQuery{Raw: query}, maxResults, 1)
+}
+
+func (c *Client) SearchPageContext(ctx context.Context, query SearchQuery, rows, page int) (*SearchAPIResponse, error) {
+	if err := query.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid search query: %w", err)
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	var result SearchAPIResponse
+	_, err := c.execute(ctx, "search request", true, func() (*resty.Response, error) {
+		return c.HTTPClient.R().
+			SetContext(ctx).
+			SetQueryParams(map[string]string{
+				"q":      c.audioQuery(query),
+				"output": "json",
+				"rows":   fmt.Sprintf("%d", rows),
+				"page":   fmt.Sprintf("%d", page),
+			}).
+			SetQueryParamsFromValues(map[string][]string{
+				"fl[]":   searchFields,
+				"sort[]": query.sortParams(),
+			}).
+			SetResult(&result).
+			Get(c.searchURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ScrapeContext walks a result set through the scrape API, which has no
+// 10,000 result ceiling. Pass an empty cursor for the first batch and the
+// returned Cursor for each following one; it is empty once results run out.
+// The API only accepts counts between 100 and 10,000.
+func (c *Client) ScrapeContext(ctx context.Context, query SearchQuery, count int, cursor string) (*ScrapeResponse, error) {
+	if err := query.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid search query: %w", err)
+	}
+	count = min(max(count, minScrapeCount), maxScrapeCount)
+
+	params := map[string]string{
+		"q":      c.audioQuery(query),
+		"fields": strings.Join(searchFields, ","),
+		"count":  fmt.Sprintf("%d", count),
+	}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+	if sorts := query.sortParams(); len(sorts) > 0 {
+		params["sorts"] = strings.Join(sorts, ",")
+	}
+
+	var result ScrapeResponse
+	_, err := c.execute(ctx, "scrape request", true, func() (*resty.Response, error) {
+		return c.HTTPClient.R().
+			SetContext(ctx).
+			SetQueryParams(params).
+			SetResult(&result).
+			Get(c.scrapeURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (c *Client) audioQuery(query SearchQuery) string {
+	return fmt.Sprintf("mediatype:audio AND %s AND %s", c.licenses.Clause(), query)
+}
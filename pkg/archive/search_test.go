@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientSearchPage(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"response":{"numFound":45,"start":20,"docs":[{"identifier":"item-21"}]}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("", WithSearchURL(server.URL))
+	result, err := client.SearchPageContext(context.Background(), SearchQuery{Text: "jazz"}, 10, 3)
+	if err != nil {
+		t.Fatalf("SearchPageContext failed: %v", err)
+	}
+
+	if got := query["page"]; len(got) != 1 || got[0] != "3" {
+		t.Errorf("Expected page=3, got %v", got)
+	}
+	if got := query["rows"]; len(got) != 1 || got[0] != "10" {
+		t.Errorf("Expected rows=10, got %v", got)
+	}
+	if result.Response.Start != 20 {
+		t.Errorf("Expected start 20, got %d", result.Response.Start)
+	}
+}
+
+func TestClientScrapeCursor(t *testing.T) {
+	var requests []map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query())
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("cursor") == "" {
+			_, _ = w.Write([]byte(`{"items":[{"identifier":"a"},{"identifier":"b"}],"count":2,"total":3,"cursor":"next-token"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[{"identifier":"c"}],"count":1,"total":3}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("", WithScrapeURL(server.URL))
+
+	first, err := client.ScrapeContext(context.Background(), SearchQuery{Text: "jazz"}, 10, "")
+	if err != nil {
+		t.Fatalf("ScrapeContext failed: %v", err)
+	}
+	if first.Cursor != "next-token" || len(first.Items) != 2 || first.Total != 3 {
+		t.Errorf("Unexpected first batch: %+v", first)
+	}
+
+	second, err := client.ScrapeContext(context.Background(), SearchQuery{Text: "jazz"}, 10, first.Cursor)
+	if err != nil {
+		t.Fatalf("ScrapeContext failed: %v", err)
+	}
+	if second.Cursor != "" || len(second.Items) != 1 || second.Items[0].Identifier != "c" {
+		t.Errorf("Unexpected second batch: %+v", second)
+	}
+
+	if got := requests[0]["count"]; len(got) != 1 || got[0] != "100" {
+		t.Errorf("Expected count clamped to 100, got %v", got)
+	}
+	if got := requests[1]["cursor"]; len(got) != 1 || got[0] != "next-token" {
+		t.Errorf("Expected cursor=next-token, got %v", got)
+	}
+}
@@ -0,0 +1,114 @@
+package archive
+
+import "strings"
+
+func (f AudioFormat) Matches(fileFormat string) bool {
+	lowerFormat := strings.ToLower(fileFormat)
+	if strings.Contains(lowerFormat, "fingerprint") {
+		return false
+	}
+	switch f {
+	case FLAC:
+		return strings.Contains(lowerFormat, "flac")
+	case Wave:
+		return strings.Contains(lowerFormat, "wave") || strings.Contains(lowerFormat, "wav")
+	case MP3:
+		return strings.Contains(lowerFormat, "mp3")
+	case OGG:
+		return strings.Contains(lowerFormat, "ogg") || strings.Contains(lowerFormat, "vorbis")
+	default:
+		return false
+	}
+}
+
+// SelectAudioFiles picks the files to download from an item listing. Files are
+// grouped into logical tracks by following derivative files back to their
+// original, and only the highest ranked format in preference is kept for each
+// track unless allFormats is set.
+func SelectAudioFiles(files []FileInfo, preference []AudioFormat, allFormats bool) []FileInfo {
+	if allFormats {
+		var selected []FileInfo
+		for _, format := range preference {
+			for _, file := range files {
+				if format.Matches(file.Format) {
+					selected = append(selected, file)
+				}
+			}
+		}
+		return selected
+	}
+
+	byName := make(map[string]FileInfo, len(files))
+	for _, file := range files {
+		byName[file.Name] = file
+	}
+
+	type candidate struct {
+		file FileInfo
+		rank int
+	}
+	var order []string
+	best := make(map[string]candidate)
+
+	for _, file := range files {
+		rank := formatRank(file.Format, preference)
+		if rank < 0 {
+			continue
+		}
+
+		track := trackKey(file, byName)
+		current, seen := best[track]
+		if !seen {
+			order = append(order, track)
+		}
+		if !seen || rank < current.rank || (rank == current.rank && file.IsOriginal() && !current.file.IsOriginal()) {
+			best[track] = candidate{file: file, rank: rank}
+		}
+	}
+
+	selected := make([]FileInfo, 0, len(order))
+	for _, track := range order {
+		selected = append(selected, best[track].file)
+	}
+	return selected
+}
+
+func formatRank(fileFormat string, preference []AudioFormat) int {
+	for i, format := range preference {
+		if format.Matches(fileFormat) {
+			return i
+		}
+	}
+	return -1
+}
+
+func trackKey(file FileInfo, byName map[string]FileInfo) string {
+	visited := map[string]bool{file.Name: true}
+	for !file.IsOriginal() {
+		original := originalName(file)
+		if original == "" {
+			break
+		}
+		parent, ok := byName[original]
+		if !ok || visited[original] {
+			return original
+		}
+		visited[original] = true
+		file = parent
+	}
+	return file.Name
+}
+
+func originalName(file FileInfo) string {
+	switch original := file.Original.(type) {
+	case string:
+		return original
+	case []interface{}:
+		for _, value := range original {
+			if name, ok := value.(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const multiFormatListing = `[
+	{"name": "show_01.flac", "source": "original", "format": "Flac"},
+	{"name": "show_01.mp3", "source": "derivative", "format": "VBR MP3", "original": "show_01.flac"},
+	{"name": "show_01.ogg", "source": "derivative", "format": "Ogg Vorbis", "original": "show_01.flac"},
+	{"name": "show_01.ffp", "source": "derivative", "format": "Flac FingerPrint", "original": "show_01.flac"},
+	{"name": "show_02.mp3", "source": "original", "format": "VBR MP3"},
+	{"name": "show_02.ogg", "source": "derivative", "format": "Ogg Vorbis", "original": "show_02.mp3"},
+	{"name": "show_02_64kb.mp3", "source": "derivative", "format": "64Kbps MP3", "original": "show_02.mp3"},
+	{"name": "show_03.ogg", "source": "derivative", "format": "Ogg Vorbis", "original": "show_03.wav"},
+	{"name": "cover.jpg", "source": "original", "format": "JPEG"}
+]`
+
+func TestSelectAudioFilesBestPerTrack(t *testing.T) {
+	var files []FileInfo
+	if err := json.Unmarshal([]byte(multiFormatListing), &files); err != nil {
+		t.Fatalf("Failed to unmarshal listing: %v", err)
+	}
+
+	selected := SelectAudioFiles(files, []AudioFormat{FLAC, Wave, MP3, OGG}, false)
+
+	expected := []string{"show_01.flac", "show_02.mp3", "show_03.ogg"}
+	if len(selected) != len(expected) {
+		t.Fatalf("Expected %d files, got %d: %+v", len(expected), len(selected), selected)
+	}
+	for i, name := range expected {
+		if selected[i].Name != name {
+			t.Errorf("Expected %s at index %d, got %s", name, i, selected[i].Name)
+		}
+	}
+}
+
+func TestSelectAudioFilesPreferenceOrder(t *testing.T) {
+	var files []FileInfo
+	if err := json.Unmarshal([]byte(multiFormatListing), &files); err != nil {
+		t.Fatalf("Failed to unmarshal listing: %v", err)
+	}
+
+	selected := SelectAudioFiles(files, []AudioFormat{OGG, MP3}, false)
+
+	expected := []string{"show_01.ogg", "show_02.ogg", "show_03.ogg"}
+	if len(selected) != len(expected) {
+		t.Fatalf("Expected %d files, got %d: %+v", len(expected), len(selected), selected)
+	}
+	for i, name := range expected {
+		if selected[i].Name != name {
+			t.Errorf("Expected %s at index %d, got %s", name, i, selected[i].Name)
+		}
+	}
+}
+
+func TestSelectAudioFilesAllFormats(t *testing.T) {
+	var files []FileInfo
+	if err := json.Unmarshal([]byte(multiFormatListing), &files); err != nil {
+		t.Fatalf("Failed to unmarshal listing: %v", err)
+	}
+
+	selected := SelectAudioFiles(files, []AudioFormat{FLAC, MP3}, true)
+
+	expected := []string{"show_01.flac", "show_01.mp3", "show_02.mp3", "show_02_64kb.mp3"}
+	if len(selected) != len(expected) {
+		t.Fatalf("Expected %d files, got %d: %+v", len(expected), len(selected), selected)
+	}
+	for i, name := range expected {
+		if selected[i].Name != name {
+			t.Errorf("Expected %s at index %d, got %s", name, i, selected[i].Name)
+		}
+	}
+}
+
+func TestAudioFormatMatches(t *testing.T) {
+	tests := []struct {
+		format     AudioFormat
+		fileFormat string
+		want       bool
+	}{
+		{FLAC, "Flac", true},
+		{FLAC, "24bit Flac", true},
+		{FLAC, "Flac FingerPrint", false},
+		{Wave, "WAVE", true},
+		{MP3, "VBR MP3", true},
+		{MP3, "Ogg Vorbis", false},
+		{OGG, "Ogg Vorbis", true},
+		{OGG, "JPEG", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.format.Matches(tt.fileFormat); got != tt.want {
+			t.Errorf("%s.Matches(%q) = %v, want %v", tt.format, tt.fileFormat, got, tt.want)
+		}
+	}
+}
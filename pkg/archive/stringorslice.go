@@ -0,0 +1,196 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// StringOrSlice holds a metadata field that archive.org returns either as a
+// single value or as a list. It marshals back to a plain string when it holds
+// exactly one value.
+type StringOrSlice []string
+
+func (s *StringOrSlice) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = nil
+		return nil
+	case len(data) > 0 && data[0] == '[':
+		var raw []json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		values := make(StringOrSlice, 0, len(raw))
+		for _, item := range raw {
+			value, err := scalarString(item)
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+		*s = values
+		return nil
+	default:
+		value, err := scalarString(data)
+		if err != nil {
+			return err
+		}
+		*s = StringOrSlice{value}
+		return nil
+	}
+}
+
+func (s StringOrSlice) MarshalJSON() ([]byte, error) {
+	if len(s) == 1 {
+		return json.Marshal(s[0])
+	}
+	return json.Marshal([]string(s))
+}
+
+// String joins the values with "; ".
+func (s StringOrSlice) String() string {
+	return strings.Join(s, "; ")
+}
+
+func (s StringOrSlice) First() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
+
+func (s StringOrSlice) Contains(value string) bool {
+	for _, v := range s {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// scalarString reads a JSON string, number or boolean as a string.
+func scalarString(data []byte) (string, error) {
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		err := json.Unmarshal(data, &value)
+		return value, err
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return "", err
+	}
+	switch value.(type) {
+	case float64, bool:
+		return string(data), nil
+	}
+	return "", fmt.Errorf("expected a string, got %s", data)
+}
+
+func (m *ItemMetadata) UnmarshalJSON(data []byte) error {
+	type plain ItemMetadata
+	extra, err := decodeMetadata(data, (*plain)(m))
+	m.Extra = extra
+	return err
+}
+
+func (m ItemMetadata) MarshalJSON() ([]byte, error) {
+	type plain ItemMetadata
+	return encodeMetadata(plain(m), m.Extra)
+}
+
+func (r *SearchResult) UnmarshalJSON(data []byte) error {
+	type plain SearchResult
+	extra, err := decodeMetadata(data, (*plain)(r))
+	r.Extra = extra
+	return err
+}
+
+func (r SearchResult) MarshalJSON() ([]byte, error) {
+	type plain SearchResult
+	return encodeMetadata(plain(r), r.Extra)
+}
+
+// decodeMetadata decodes a metadata object into the struct v points to.
+// String fields tolerate numbers and booleans, and keys without a matching
+// field are returned.
+func decodeMetadata(data []byte, v any) (map[string]json.RawMessage, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	fields := jsonFields(reflect.TypeOf(v).Elem())
+	var extra map[string]json.RawMessage
+	for key, value := range raw {
+		kind, known := fields[key]
+		if !known {
+			if extra == nil {
+				extra = make(map[string]json.RawMessage)
+			}
+			extra[key] = value
+			continue
+		}
+		if kind == reflect.String && len(value) > 0 && value[0] != '"' {
+			scalar, err := scalarString(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", key, err)
+			}
+			raw[key], _ = json.Marshal(scalar)
+		}
+	}
+
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	return extra, json.Unmarshal(normalized, v)
+}
+
+// encodeMetadata marshals v and adds the extra fields back, so decoding and
+// encoding an item loses nothing. Declared fields win over extra ones.
+func encodeMetadata(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range extra {
+		if _, ok := merged[key]; !ok {
+			merged[key] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+var jsonFieldCache sync.Map
+
+// jsonFields maps the JSON names of a struct's fields to their kinds.
+func jsonFields(t reflect.Type) map[string]reflect.Kind {
+	if cached, ok := jsonFieldCache.Load(t); ok {
+		return cached.(map[string]reflect.Kind)
+	}
+
+	fields := make(map[string]reflect.Kind)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type.Kind()
+	}
+	jsonFieldCache.Store(t, fields)
+	return fields
+}
@@ -1,5 +1,7 @@
 package archive
 
+import "encoding/json"
+
 type AudioFormat string
 
 const (
@@ -26,14 +28,27 @@ type SearchResponse struct {
 	Docs     []SearchResult `json:"docs"`
 }
 
+type ScrapeResponse struct {
+	Items  []SearchResult `json:"items"`
+	Count  int            `json:"count"`
+	Total  int            `json:"total"`
+	Cursor string         `json:"cursor,omitempty"`
+}
+
 type SearchResult struct {
-	Identifier  string `json:"identifier"`
-	Title       string `json:"title,omitempty"`
-	Description string `json:"description,omitempty"`
-	Creator     string `json:"creator,omitempty"`
-	Date        string `json:"date,omitempty"`
-	LicenseURL  string `json:"licenseurl,omitempty"`
-	MediaType   string `json:"mediatype,omitempty"`
+	Identifier  string        `json:"identifier"`
+	Title       StringOrSlice `json:"title,omitempty"`
+	Description StringOrSlice `json:"description,omitempty"`
+	Creator     StringOrSlice `json:"creator,omitempty"`
+	Date        StringOrSlice `json:"date,omitempty"`
+	Year        StringOrSlice `json:"year,omitempty"`
+	Subject     StringOrSlice `json:"subject,omitempty"`
+	Collection  StringOrSlice `json:"collection,omitempty"`
+	Language    StringOrSlice `json:"language,omitempty"`
+	LicenseURL  StringOrSlice `json:"licenseurl,omitempty"`
+	MediaType   string        `json:"mediatype,omitempty"`
+	// Extra holds fields without a dedicated member, as returned.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 type MetadataResponse struct {
@@ -50,6 +65,7 @@ type MetadataResponse struct {
 	Files              []FileInfo          `json:"files"`
 	Metadata           ItemMetadata        `json:"metadata"`
 	AlternateLocations *AlternateLocations `json:"alternate_locations,omitempty"`
+	IsDark             bool                `json:"is_dark,omitempty"`
 }
 
 type FileInfo struct {
@@ -68,22 +84,50 @@ type FileInfo struct {
 	BTIH     string      `json:"btih,omitempty"`
 	Rotation string      `json:"rotation,omitempty"`
 	Original interface{} `json:"original,omitempty"`
+	Title    string      `json:"title,omitempty"`
+	Creator  string      `json:"creator,omitempty"`
+	Album    string      `json:"album,omitempty"`
+	Track    string      `json:"track,omitempty"`
+	Disc     string      `json:"disc,omitempty"`
 }
 
+// ItemMetadata holds an item's metadata. Fields uploaders fill in may hold
+// several values and are StringOrSlice; the identifier, media type, uploader,
+// dates and access flag are set by archive.org itself, once per item, and
+// stay plain strings.
 type ItemMetadata struct {
-	Identifier  string   `json:"identifier"`
-	Title       string   `json:"title,omitempty"`
-	Creator     string   `json:"creator,omitempty"`
-	Date        string   `json:"date,omitempty"`
-	Description string   `json:"description,omitempty"`
-	MediaType   string   `json:"mediatype,omitempty"`
-	Collection  interface{} `json:"collection,omitempty"`
-	Subject     string   `json:"subject,omitempty"`
-	Scanner     string   `json:"scanner,omitempty"`
-	Uploader    string   `json:"uploader,omitempty"`
-	PublicDate  string   `json:"publicdate,omitempty"`
-	AddedDate   string   `json:"addeddate,omitempty"`
-	LicenseURL  string   `json:"licenseurl,omitempty"`
+	Identifier              string        `json:"identifier"`
+	Title                   StringOrSlice `json:"title,omitempty"`
+	Creator                 StringOrSlice `json:"creator,omitempty"`
+	Date                    StringOrSlice `json:"date,omitempty"`
+	Year                    StringOrSlice `json:"year,omitempty"`
+	Description             StringOrSlice `json:"description,omitempty"`
+	MediaType               string        `json:"mediatype,omitempty"`
+	Collection              StringOrSlice `json:"collection,omitempty"`
+	Subject                 StringOrSlice `json:"subject,omitempty"`
+	Language                StringOrSlice `json:"language,omitempty"`
+	Runtime                 StringOrSlice `json:"runtime,omitempty"`
+	Venue                   StringOrSlice `json:"venue,omitempty"`
+	Source                  StringOrSlice `json:"source,omitempty"`
+	Notes                   StringOrSlice `json:"notes,omitempty"`
+	ExternalIdentifier      StringOrSlice `json:"external-identifier,omitempty"`
+	Scanner                 StringOrSlice `json:"scanner,omitempty"`
+	Uploader                string        `json:"uploader,omitempty"`
+	PublicDate              string        `json:"publicdate,omitempty"`
+	AddedDate               string        `json:"addeddate,omitempty"`
+	LicenseURL              StringOrSlice `json:"licenseurl,omitempty"`
+	Rights                  StringOrSlice `json:"rights,omitempty"`
+	PossibleCopyrightStatus StringOrSlice `json:"possible-copyright-status,omitempty"`
+	AccessRestrictedItem    string        `json:"access-restricted-item,omitempty"`
+	// Extra holds fields without a dedicated member, as returned.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type CredentialsResponse struct {
+	Authorized bool   `json:"authorized"`
+	AccessKey  string `json:"accesskey,omitempty"`
+	Username   string `json:"username,omitempty"`
+	ScreenName string `json:"screenname,omitempty"`
 }
 
 type AlternateLocations struct {
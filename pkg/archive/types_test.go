@@ -2,6 +2,7 @@ package archive
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -99,3 +100,90 @@ func TestAudioFormatConstants(t *testing.T) {
 		}
 	}
 }
+
+func TestItemMetadataMultiValueFields(t *testing.T) {
+	jsonData := `{
+		"identifier": "multi-item",
+		"title": ["Part One", "Part Two"],
+		"creator": ["Orson Welles", "Mercury Theatre"],
+		"subject": "radio drama",
+		"collection": ["oldtimeradio", "audio_bookspoetry"],
+		"description": ["First.", "Second."],
+		"language": "eng",
+		"year": 1938,
+		"runtime": "59:12",
+		"venue": "CBS Studio One",
+		"source": "Transcription discs",
+		"notes": ["Restored", "Noise reduced"],
+		"external-identifier": ["urn:oclc:123", "urn:isbn:456"],
+		"access-restricted-item": true,
+		"scanningcenter": "sanfrancisco",
+		"taper": ["Someone"]
+	}`
+
+	var meta ItemMetadata
+	if err := json.Unmarshal([]byte(jsonData), &meta); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if len(meta.Creator) != 2 || meta.Creator[1] != "Mercury Theatre" {
+		t.Errorf("Expected two creators, got %v", meta.Creator)
+	}
+
+	if len(meta.Subject) != 1 || meta.Subject.First() != "radio drama" {
+		t.Errorf("Expected single subject, got %v", meta.Subject)
+	}
+
+	if len(meta.Title) != 2 || meta.Title[1] != "Part Two" {
+		t.Errorf("Expected two titles, got %v", meta.Title)
+	}
+
+	if meta.Year.First() != "1938" || meta.Runtime.First() != "59:12" || meta.AccessRestrictedItem != "true" {
+		t.Errorf("Expected scalar values as strings, got year=%v runtime=%v restricted=%q", meta.Year, meta.Runtime, meta.AccessRestrictedItem)
+	}
+
+	if !meta.Collection.Contains("oldtimeradio") || meta.Venue.First() != "CBS Studio One" || len(meta.Notes) != 2 || len(meta.ExternalIdentifier) != 2 {
+		t.Errorf("Unexpected multi-value fields: %+v", meta)
+	}
+
+	if len(meta.Extra) != 2 || string(meta.Extra["scanningcenter"]) != `"sanfrancisco"` {
+		t.Errorf("Expected unknown fields in Extra, got %v", meta.Extra)
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var roundTrip map[string]any
+	if err := json.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatalf("Failed to unmarshal round trip: %v", err)
+	}
+	if roundTrip["subject"] != "radio drama" || roundTrip["scanningcenter"] != "sanfrancisco" || len(roundTrip["creator"].([]any)) != 2 {
+		t.Errorf("Expected fields preserved on marshal, got %v", roundTrip)
+	}
+}
+
+func TestSearchResultMultiValueFields(t *testing.T) {
+	jsonData := `{"identifier": "a", "creator": ["One", "Two"], "description": "Only", "downloads": 12}`
+
+	var result SearchResult
+	if err := json.Unmarshal([]byte(jsonData), &result); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if result.Creator.String() != "One; Two" || result.Description.First() != "Only" {
+		t.Errorf("Unexpected fields: %+v", result)
+	}
+
+	if string(result.Extra["downloads"]) != "12" {
+		t.Errorf("Expected downloads in Extra, got %v", result.Extra)
+	}
+}
+
+func TestItemMetadataRejectsArrayInScalarField(t *testing.T) {
+	var meta ItemMetadata
+	err := json.Unmarshal([]byte(`{"identifier": "a", "mediatype": ["audio", "etree"]}`), &meta)
+	if err == nil || !strings.Contains(err.Error(), "mediatype") {
+		t.Errorf("Expected error naming mediatype, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package archive
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	DefaultUploadPartSize int64 = 64 << 20
+	MinUploadPartSize     int64 = 5 << 20
+)
+
+var ErrEmptyUploadName = errors.New("upload file name cannot be empty")
+
+type (
+	// UploadMetadata describes a new item. It is sent as x-archive-meta-*
+	// headers with the first file uploaded, which creates the item.
+	UploadMetadata struct {
+		Title       string
+		Creator     string
+		Date        string
+		Description string
+		MediaType   string
+		Language    string
+		LicenseURL  string
+		Collection  []string
+		Subject     []string
+		// Extra holds any other fields, keyed by their archive.org name.
+		Extra map[string][]string
+	}
+	initiateMultipartUploadResult struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		UploadID string   `xml:"UploadId"`
+	}
+	completeMultipartUpload struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+	completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+)
+
+func WithUploadPartSize(size int64) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.partSize = size
+		}
+	}
+}
+
+// Headers returns the metadata as IA-S3 headers. Repeated values are numbered
+// (x-archive-meta01-subject, x-archive-meta02-subject), underscores in field
+// names become "--" and values that are not plain ASCII are sent as uri(...).
+func (m UploadMetadata) Headers() http.Header {
+	fields := map[string][]string{
+		"title":       {m.Title},
+		"creator":     {m.Creator},
+		"date":        {m.Date},
+		"description": {m.Description},
+		"mediatype":   {m.MediaType},
+		"language":    {m.Language},
+		"licenseurl":  {m.LicenseURL},
+		"collection":  m.Collection,
+		"subject":     m.Subject,
+	}
+	for name, values := range m.Extra {
+		fields[strings.ToLower(name)] = values
+	}
+
+	header := http.Header{}
+	for name, values := range fields {
+		var nonEmpty []string
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				nonEmpty = append(nonEmpty, value)
+			}
+		}
+
+		name = strings.ReplaceAll(name, "_", "--")
+		switch len(nonEmpty) {
+		case 0:
+		case 1:
+			header.Set("x-archive-meta-"+name, headerValue(nonEmpty[0]))
+		default:
+			for i, value := range nonEmpty {
+				header.Set(fmt.Sprintf("x-archive-meta%02d-%s", i+1, name), headerValue(value))
+			}
+		}
+	}
+	return header
+}
+
+func headerValue(value string) string {
+	for _, r := range value {
+		if r < 0x20 || r > 0x7e {
+			return "uri(" + url.PathEscape(value) + ")"
+		}
+	}
+	return value
+}
+
+// UploadFile uploads the local file at path into the item as name, creating
+// the item from meta if it does not exist yet. Files larger than the upload
+// part size are sent with an S3 multipart upload. Uploads need credentials.
+func (c *Client) UploadFile(ctx context.Context, identifier, name, path string, meta UploadMetadata, progress ProgressFunc) error {
+	if err := ValidateIdentifier(identifier); err != nil {
+		return err
+	}
+	if strings.Trim(name, "/") == "" {
+		return ErrEmptyUploadName
+	}
+	if !c.HasCredentials() {
+		return ErrNoCredentials
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to inspect upload: %w", err)
+	}
+	size := info.Size()
+
+	objectURL := fmt.Sprintf("%s/%s/%s", c.s3URL, identifier, escapeFilePath(name))
+	header := meta.Headers()
+	header.Set("x-archive-auto-make-bucket", "1")
+	header.Set("x-archive-size-hint", strconv.FormatInt(size, 10))
+
+	if progress != nil {
+		progress(0, size)
+	}
+
+	if size <= c.partSize {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("failed to read upload: %w", err)
+		}
+		if _, err := c.putPart(ctx, "upload", objectURL, header, data); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(size, size)
+		}
+		return nil
+	}
+
+	return c.multipartUpload(ctx, objectURL, header, f, size, progress)
+}
+
+func (c *Client) multipartUpload(ctx context.Context, objectURL string, header http.Header, f *os.File, size int64, progress ProgressFunc) error {
+	resp, err := c.execute(ctx, "multipart upload initiation", false, func() (*resty.Response, error) {
+		return c.request(ctx).
+			SetHeaderMultiValues(header).
+			Post(objectURL + "?uploads")
+	})
+	if err != nil {
+		return err
+	}
+
+	var initiated initiateMultipartUploadResult
+	if err := xml.Unmarshal(resp.Body(), &initiated); err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("multipart upload initiation returned no upload id: %w", errors.Join(err, ErrUnavailable))
+	}
+	uploadURL := objectURL + "?uploadId=" + url.QueryEscape(initiated.UploadID)
+
+	var complete completeMultipartUpload
+	buf := make([]byte, c.partSize)
+	var written int64
+	for number := 1; written < size; number++ {
+		n, err := io.ReadFull(f, buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			c.abortMultipartUpload(ctx, uploadURL)
+			return fmt.Errorf("failed to read upload: %w", err)
+		}
+
+		partURL := fmt.Sprintf("%s&partNumber=%d", uploadURL, number)
+		etag, err := c.putPart(ctx, fmt.Sprintf("upload of part %d", number), partURL, nil, buf[:n])
+		if err != nil {
+			c.abortMultipartUpload(ctx, uploadURL)
+			return err
+		}
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: number, ETag: etag})
+
+		written += int64(n)
+		if progress != nil {
+			progress(written, size)
+		}
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		c.abortMultipartUpload(ctx, uploadURL)
+		return fmt.Errorf("failed to encode multipart completion: %w", err)
+	}
+
+	_, err = c.execute(ctx, "multipart upload completion", false, func() (*resty.Response, error) {
+		return c.request(ctx).
+			SetHeader("Content-Type", "application/xml").
+			SetBody(body).
+			Post(uploadURL)
+	})
+	if err != nil {
+		c.abortMultipartUpload(ctx, uploadURL)
+		return err
+	}
+
+	return nil
+}
+
+// putPart sends data with its Content-MD5 so the server rejects corrupted
+// bodies, and returns the ETag of the stored object or part.
+func (c *Client) putPart(ctx context.Context, op, target string, header http.Header, data []byte) (string, error) {
+	sum := md5.Sum(data)
+	resp, err := c.execute(ctx, op, true, func() (*resty.Response, error) {
+		return c.request(ctx).
+			SetHeaderMultiValues(header).
+			SetHeader("Content-MD5", base64.StdEncoding.EncodeToString(sum[:])).
+			SetBody(data).
+			Put(target)
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Header().Get("ETag"), nil
+}
+
+// abortMultipartUpload discards the parts of a failed upload. It runs even
+// when ctx was cancelled, and its own failure is ignored: archive.org expires
+// abandoned uploads anyway.
+func (c *Client) abortMultipartUpload(ctx context.Context, uploadURL string) {
+	ctx = context.WithoutCancel(ctx)
+	_, _ = c.request(ctx).Delete(uploadURL)
+}
@@ -0,0 +1,45 @@
+package archive
+
+import (
+	"testing"
+)
+
+func TestUploadMetadataHeaders(t *testing.T) {
+	meta := UploadMetadata{
+		Title:      "Café Sessions",
+		Creator:    "Restoration Team",
+		MediaType:  "audio",
+		Collection: []string{"opensource_audio"},
+		Subject:    []string{"jazz", " ", "restoration"},
+		Extra:      map[string][]string{"external_identifier": {"urn:test:1"}},
+	}
+
+	header := meta.Headers()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"x-archive-meta-title", "uri(Caf%C3%A9%20Sessions)"},
+		{"x-archive-meta-creator", "Restoration Team"},
+		{"x-archive-meta-mediatype", "audio"},
+		{"x-archive-meta-collection", "opensource_audio"},
+		{"x-archive-meta01-subject", "jazz"},
+		{"x-archive-meta02-subject", "restoration"},
+		{"x-archive-meta-external--identifier", "urn:test:1"},
+		{"x-archive-meta-date", ""},
+		{"x-archive-meta03-subject", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := header.Get(tt.name); got != tt.want {
+				t.Errorf("Expected %s %q, got %q", tt.name, tt.want, got)
+			}
+		})
+	}
+
+	if len(header) != 7 {
+		t.Errorf("Expected 7 headers, got %d: %v", len(header), header)
+	}
+}
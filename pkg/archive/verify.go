@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrNoChecksums is returned by VerifyFile for files archive.org publishes
+	// no checksums for.
+	ErrNoChecksums = errors.New("no checksums to verify against")
+)
+
+type (
+	Checksums struct {
+		MD5   string `json:"md5,omitempty"`
+		SHA1  string `json:"sha1,omitempty"`
+		CRC32 string `json:"crc32,omitempty"`
+	}
+	// Verifier hashes everything written to it with MD5, SHA1 and CRC32 in a
+	// single pass and compares the digests with a file's published checksums.
+	Verifier struct {
+		file    FileInfo
+		md5     hash.Hash
+		sha1    hash.Hash
+		crc32   hash.Hash32
+		written int64
+	}
+)
+
+func NewVerifier(file FileInfo) *Verifier {
+	return &Verifier{file: file, md5: md5.New(), sha1: sha1.New(), crc32: crc32.NewIEEE()}
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	_, _ = v.md5.Write(p)
+	_, _ = v.sha1.Write(p)
+	_, _ = v.crc32.Write(p)
+	v.written += int64(len(p))
+	return len(p), nil
+}
+
+func (v *Verifier) Reset() {
+	v.md5.Reset()
+	v.sha1.Reset()
+	v.crc32.Reset()
+	v.written = 0
+}
+
+// Written returns the number of bytes hashed since the last Reset.
+func (v *Verifier) Written() int64 {
+	return v.written
+}
+
+func (v *Verifier) Sums() Checksums {
+	return Checksums{
+		MD5:   hex.EncodeToString(v.md5.Sum(nil)),
+		SHA1:  hex.EncodeToString(v.sha1.Sum(nil)),
+		CRC32: hex.EncodeToString(v.crc32.Sum(nil)),
+	}
+}
+
+// Checked lists the checksums Verify compares, in the order it compares them.
+func (v *Verifier) Checked() []string {
+	var names []string
+	for _, check := range v.checks(Checksums{}) {
+		names = append(names, check.name)
+	}
+	return names
+}
+
+// Verify compares the size and digests of what was written with the file's
+// metadata. Checksums archive.org did not publish are not compared.
+func (v *Verifier) Verify() error {
+	if expected := v.file.SizeBytes(); expected > 0 && expected != v.written {
+		return fmt.Errorf("%w: %s size: expected %d, got %d", ErrChecksumMismatch, v.file.Name, expected, v.written)
+	}
+	for _, check := range v.checks(v.Sums()) {
+		if !strings.EqualFold(check.expected, check.actual) {
+			return fmt.Errorf("%w: %s %s: expected %s, got %s", ErrChecksumMismatch, v.file.Name, check.name, check.expected, check.actual)
+		}
+	}
+	return nil
+}
+
+type checksumCheck struct {
+	name, expected, actual string
+}
+
+func (v *Verifier) checks(actual Checksums) []checksumCheck {
+	var checks []checksumCheck
+	for _, check := range []checksumCheck{
+		{"md5", v.file.MD5, actual.MD5},
+		{"sha1", v.file.SHA1, actual.SHA1},
+		{"crc32", v.file.CRC32, actual.CRC32},
+	} {
+		if check.expected != "" {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// catchUp makes the verifier cover the first offset bytes of path, rehashing
+// them when what it has seen so far does not line up with the file.
+func (v *Verifier) catchUp(path string, offset int64) error {
+	if v.written == offset {
+		return nil
+	}
+	v.Reset()
+	if offset == 0 {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open partial file for verification: %w", err)
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+
+	if _, err := io.CopyN(v, f, offset); err != nil {
+		return fmt.Errorf("failed to read partial file for verification: %w", err)
+	}
+	return nil
+}
+
+// VerifyFile checks a local copy of file against its published size and
+// checksums. It returns ErrNoChecksums when the size matches, or is not
+// published, but there are no checksums to compare, and an error satisfying
+// os.IsNotExist when path does not exist.
+func VerifyFile(path string, file FileInfo) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+
+	v := NewVerifier(file)
+	if len(v.Checked()) == 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to inspect file for verification: %w", err)
+		}
+		if expected := file.SizeBytes(); expected > 0 && expected != info.Size() {
+			return fmt.Errorf("%w: %s size: expected %d, got %d", ErrChecksumMismatch, file.Name, expected, info.Size())
+		}
+		return fmt.Errorf("%s: %w", file.Name, ErrNoChecksums)
+	}
+
+	if _, err := io.Copy(v, f); err != nil {
+		return fmt.Errorf("failed to read file for verification: %w", err)
+	}
+	return v.Verify()
+}
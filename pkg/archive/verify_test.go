@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Digests of "The quick brown fox jumps over the lazy dog".
+var foxFile = FileInfo{
+	Name:  "fox.txt",
+	Size:  "43",
+	MD5:   "9e107d9d372bb6826bd81d3542a419d6",
+	SHA1:  "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12",
+	CRC32: "414fa339",
+}
+
+const foxContent = "The quick brown fox jumps over the lazy dog"
+
+func TestVerifier(t *testing.T) {
+	v := NewVerifier(foxFile)
+	_, _ = v.Write([]byte(foxContent[:10]))
+	_, _ = v.Write([]byte(foxContent[10:]))
+
+	sums := v.Sums()
+	if sums.MD5 != foxFile.MD5 || sums.SHA1 != foxFile.SHA1 || sums.CRC32 != foxFile.CRC32 {
+		t.Errorf("Unexpected checksums: %+v", sums)
+	}
+	if err := v.Verify(); err != nil {
+		t.Errorf("Expected verification to pass, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		file FileInfo
+	}{
+		{"md5", FileInfo{Name: "fox.txt", MD5: "00000000000000000000000000000000"}},
+		{"sha1", FileInfo{Name: "fox.txt", SHA1: "0000000000000000000000000000000000000000"}},
+		{"crc32", FileInfo{Name: "fox.txt", CRC32: "00000000"}},
+		{"size", FileInfo{Name: "fox.txt", Size: "44", MD5: foxFile.MD5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(tt.file)
+			_, _ = v.Write([]byte(foxContent))
+			if err := v.Verify(); !errors.Is(err, ErrChecksumMismatch) {
+				t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifierCatchUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fox.txt.part")
+	if err := os.WriteFile(path, []byte(foxContent[:20]), 0644); err != nil {
+		t.Fatalf("Failed to write partial file: %v", err)
+	}
+
+	v := NewVerifier(foxFile)
+	_, _ = v.Write([]byte("stale"))
+	if err := v.catchUp(path, 20); err != nil {
+		t.Fatalf("catchUp failed: %v", err)
+	}
+	_, _ = v.Write([]byte(foxContent[20:]))
+	if err := v.Verify(); err != nil {
+		t.Errorf("Expected verification to pass after catching up, got %v", err)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fox.txt")
+	if err := os.WriteFile(path, []byte(foxContent), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := VerifyFile(path, foxFile); err != nil {
+		t.Errorf("Expected file to verify, got %v", err)
+	}
+	if err := VerifyFile(path, FileInfo{Name: "fox.txt", Size: "43"}); !errors.Is(err, ErrNoChecksums) {
+		t.Errorf("Expected ErrNoChecksums, got %v", err)
+	}
+	if err := VerifyFile(path, FileInfo{Name: "fox.txt", Size: "44"}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch for the wrong size without checksums, got %v", err)
+	}
+	if err := VerifyFile(filepath.Join(dir, "missing.txt"), foxFile); !os.IsNotExist(err) {
+		t.Errorf("Expected a not-exist error, got %v", err)
+	}
+}
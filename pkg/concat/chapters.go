@@ -0,0 +1,87 @@
+package concat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	FormatM4B = "m4b"
+	FormatMKA = "mka"
+)
+
+var ChapterFormats = []string{FormatM4B, FormatMKA}
+
+type (
+	// Chapter marks where one part of a chapterized file starts and ends.
+	Chapter struct {
+		Title string
+		Start time.Duration
+		End   time.Duration
+	}
+	// ChapterList is the metadata written into a chapterized file: the title
+	// and artist of the whole file and a chapter per part.
+	ChapterList struct {
+		Title    string
+		Artist   string
+		Chapters []Chapter
+	}
+)
+
+// Chapters lays out a chapter for each of files, back to back. Titles and
+// durations come from the item metadata; a blank title falls back to the
+// file name, and parts whose duration is unknown are measured.
+func Chapters(files, titles []string, durations []time.Duration) ([]Chapter, error) {
+	if len(titles) != len(files) || len(durations) != len(files) {
+		return nil, fmt.Errorf("need a title and duration for each of %d parts", len(files))
+	}
+
+	chapters := make([]Chapter, 0, len(files))
+	var start time.Duration
+	for i, file := range files {
+		duration := durations[i]
+		if duration <= 0 {
+			measured, err := ProbeDuration(file)
+			if err != nil {
+				return nil, fmt.Errorf("cannot place the chapter for part %d: %w", i+1, err)
+			}
+			duration = measured
+		}
+
+		title := strings.TrimSpace(titles[i])
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		chapters = append(chapters, Chapter{Title: title, Start: start, End: start + duration})
+		start += duration
+	}
+	return chapters, nil
+}
+
+// WriteFFMetadata writes list in ffmpeg's FFMETADATA format, with chapter
+// times in milliseconds.
+func WriteFFMetadata(w io.Writer, list ChapterList) error {
+	out := bufio.NewWriter(w)
+	out.WriteString(";FFMETADATA1\n")
+	if list.Title != "" {
+		fmt.Fprintf(out, "title=%s\n", escapeFFMetadata(list.Title))
+	}
+	if list.Artist != "" {
+		fmt.Fprintf(out, "artist=%s\n", escapeFFMetadata(list.Artist))
+	}
+	for _, chapter := range list.Chapters {
+		fmt.Fprintf(out, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			chapter.Start.Milliseconds(), chapter.End.Milliseconds(), escapeFFMetadata(chapter.Title))
+	}
+	return out.Flush()
+}
+
+var ffmetadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+func escapeFFMetadata(value string) string {
+	return ffmetadataEscaper.Replace(value)
+}
@@ -0,0 +1,129 @@
+package concat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChapters(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		filepath.Join(dir, "book_01.mp3"),
+		filepath.Join(dir, "book_02.wav"),
+		filepath.Join(dir, "book_03.mp3"),
+	}
+	// One second of 8 kHz mono 8-bit audio.
+	if err := os.WriteFile(files[1], wavFile(8000, 1, 8, make([]byte, 8000)), 0644); err != nil {
+		t.Fatalf("Failed to write part: %v", err)
+	}
+
+	chapters, err := Chapters(files, []string{"Chapter 1: Loomings", " ", "Chapter 3"},
+		[]time.Duration{90 * time.Second, 0, 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Chapters failed: %v", err)
+	}
+	expected := []Chapter{
+		{Title: "Chapter 1: Loomings", Start: 0, End: 90 * time.Second},
+		{Title: "book_02", Start: 90 * time.Second, End: 91 * time.Second},
+		{Title: "Chapter 3", Start: 91 * time.Second, End: 92500 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(chapters, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, chapters)
+	}
+
+	if _, err := Chapters(files[:1], []string{""}, []time.Duration{0}); err == nil {
+		t.Error("Expected an error for a part without a known duration")
+	}
+}
+
+func TestWriteFFMetadata(t *testing.T) {
+	var out bytes.Buffer
+	err := WriteFFMetadata(&out, ChapterList{
+		Title:  "Moby Dick; or, The Whale",
+		Artist: "Herman Melville",
+		Chapters: []Chapter{
+			{Title: "Loomings", Start: 0, End: 90 * time.Second},
+			{Title: "The Carpet-Bag #2 = a\\b", Start: 90 * time.Second, End: 95500 * time.Millisecond},
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteFFMetadata failed: %v", err)
+	}
+
+	expected := `;FFMETADATA1
+title=Moby Dick\; or, The Whale
+artist=Herman Melville
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=90000
+title=Loomings
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=90000
+END=95500
+title=The Carpet-Bag \#2 \= a\\b
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestProbeDuration(t *testing.T) {
+	xing := mp3Frames(false, true, 9, 9)
+	binary.BigEndian.PutUint32(xing[4+32+4:], xingFrames)
+	binary.BigEndian.PutUint32(xing[4+32+8:], 1000)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected time.Duration
+	}{
+		{"wav", wavFile(8000, 2, 16, make([]byte, 16000)), 500 * time.Millisecond},
+		{"flac", flacFile(44100, 2, 16, 88200, nil), 2 * time.Second},
+		// 417 bytes per 128 kbit/s frame, so 3 frames last 78 ms.
+		{"cbr mp3", mp3Frames(false, false, 9, 9, 9), 78 * time.Millisecond},
+		{"xing mp3", xing, 26122 * time.Millisecond},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", tt.name, err)
+			}
+			got, err := ProbeDuration(path)
+			if err != nil {
+				t.Fatalf("ProbeDuration failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPlanChapterizedOutput(t *testing.T) {
+	mp3 := StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, Bitrate: 64}
+
+	plan := planFor([]StreamInfo{mp3, mp3}, ".m4b")
+	expected := StreamInfo{Codec: CodecAAC, SampleRate: 44100, Channels: 2, Bitrate: 64}
+	if plan.Path != PathReencode || plan.Target != expected {
+		t.Errorf("Expected an AAC re-encode for M4B, got %+v", plan)
+	}
+	if args := encoderArgs(plan.Target); !reflect.DeepEqual(args, []string{"-c:a", "aac", "-b:a", "64k"}) {
+		t.Errorf("Unexpected AAC encoder arguments %q", args)
+	}
+
+	if plan := planFor([]StreamInfo{mp3, mp3}, ".mka"); plan.Path != PathCopy {
+		t.Errorf("Expected matching parts to be copied into MKA, got %+v", plan)
+	}
+}
@@ -1,119 +1,233 @@
 package concat
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 )
 
-type MultiPartSet struct {
-	BasePattern string
-	Files       []string
-	OutputName  string
+type ProgressFunc func(written int64)
+
+func CheckFFMPEG(ffmpegBin string) error {
+	cmd := exec.Command(ffmpegBin, "-version")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg not found or not executable at %s: %w", ffmpegBin, err)
+	}
+	return nil
 }
 
-var partPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`[_-]Part[_-](\d+)`),
-	regexp.MustCompile(`[_-]part[_-](\d+)`),
-	regexp.MustCompile(`[_-](\d+)$`),
-	regexp.MustCompile(`\((\d+)\)`),
+func ConcatenateFiles(ffmpegBin string, files []string, outputPath string) error {
+	_, err := ConcatenateFilesContext(context.Background(), ffmpegBin, files, outputPath, nil)
+	return err
 }
 
-func DetectMultiPartSets(files []string) []MultiPartSet {
-	sets := make(map[string]*MultiPartSet)
+// ConcatenateFilesContext joins files into outputPath with ffmpeg. The parts
+// are probed first, and the returned Plan says whether they were stream
+// copied or re-encoded, and why.
+func ConcatenateFilesContext(ctx context.Context, ffmpegBin string, files []string, outputPath string, progress ProgressFunc) (Plan, error) {
+	return concatenate(ctx, ffmpegBin, files, outputPath, nil, progress)
+}
+
+// ChapterizeContext joins files like ConcatenateFilesContext and marks each
+// part as a chapter of the output, which should be an M4B or MKA file.
+func ChapterizeContext(ctx context.Context, ffmpegBin string, files []string, outputPath string, chapters ChapterList, progress ProgressFunc) (Plan, error) {
+	if len(chapters.Chapters) != len(files) {
+		return Plan{}, fmt.Errorf("expected %d chapters, got %d", len(files), len(chapters.Chapters))
+	}
+	return concatenate(ctx, ffmpegBin, files, outputPath, &chapters, progress)
+}
+
+func concatenate(ctx context.Context, ffmpegBin string, files []string, outputPath string, chapters *ChapterList, progress ProgressFunc) (Plan, error) {
+	if len(files) == 0 {
+		return Plan{}, fmt.Errorf("no files to concatenate")
+	}
 
+	absPaths := make([]string, 0, len(files))
 	for _, file := range files {
-		ext := filepath.Ext(file)
-		baseName := strings.TrimSuffix(file, ext)
-
-		for _, pattern := range partPatterns {
-			if matches := pattern.FindStringSubmatch(baseName); matches != nil {
-				basePattern := pattern.ReplaceAllString(baseName, "")
-				key := basePattern + ext
-
-				if _, exists := sets[key]; !exists {
-					sets[key] = &MultiPartSet{
-						BasePattern: basePattern,
-						Files:       []string{},
-						OutputName:  basePattern + ext,
-					}
-				}
-				sets[key].Files = append(sets[key].Files, file)
-				break
-			}
+		absPath, err := filepath.Abs(file)
+		if err != nil {
+			return Plan{}, fmt.Errorf("failed to get absolute path for %s: %w", file, err)
 		}
+		absPaths = append(absPaths, absPath)
 	}
 
-	var result []MultiPartSet
-	for _, set := range sets {
-		if len(set.Files) > 1 {
-			sort.Strings(set.Files)
-			result = append(result, *set)
+	plan := PlanConcat(absPaths, filepath.Ext(outputPath))
+	plan.Backend = BackendFFMPEG
+
+	var inputs, outputs []string
+	inputCount := len(absPaths)
+	if plan.Path == PathCopy {
+		concatListFile := outputPath + ".concat_list.txt"
+		defer func(name string) { _ = os.Remove(name) }(concatListFile)
+
+		var listContent strings.Builder
+		for _, absPath := range absPaths {
+			listContent.WriteString(fmt.Sprintf("file '%s'\n", absPath))
 		}
+		if err := os.WriteFile(concatListFile, []byte(listContent.String()), 0644); err != nil {
+			return plan, fmt.Errorf("failed to create concat list file: %w", err)
+		}
+		inputs = []string{"-f", "concat", "-safe", "0", "-i", concatListFile}
+		outputs = []string{"-c", "copy"}
+		inputCount = 1
+	} else {
+		args := reencodeArgs(absPaths, plan.Target)
+		inputs, outputs = slices.Clip(args[:2*inputCount]), args[2*inputCount:]
 	}
 
-	return result
-}
+	if chapters != nil {
+		metadataFile := outputPath + ".ffmetadata.txt"
+		defer func(name string) { _ = os.Remove(name) }(metadataFile)
 
-func CheckFFMPEG(ffmpegBin string) error {
-	cmd := exec.Command(ffmpegBin, "-version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg not found or not executable at %s: %w", ffmpegBin, err)
+		var metadata bytes.Buffer
+		if err := WriteFFMetadata(&metadata, *chapters); err != nil {
+			return plan, err
+		}
+		if err := os.WriteFile(metadataFile, metadata.Bytes(), 0644); err != nil {
+			return plan, fmt.Errorf("failed to create chapter metadata file: %w", err)
+		}
+		inputs = append(inputs, "-i", metadataFile)
+		outputs = append(chapterArgs(inputCount), outputs...)
 	}
-	return nil
-}
 
-func ConcatenateFiles(ffmpegBin string, files []string, outputPath string) error {
-	if len(files) == 0 {
-		return fmt.Errorf("no files to concatenate")
+	args := append(slices.Clip(inputs), outputs...)
+	if progress != nil {
+		args = append(args, "-progress", "pipe:1", "-nostats")
 	}
 
-	ext := strings.ToLower(filepath.Ext(files[0]))
+	args = append(args, outputPath)
 
-	concatListFile := outputPath + ".concat_list.txt"
-	defer func(name string) { _ = os.Remove(name) }(concatListFile)
+	cmd := exec.CommandContext(ctx, ffmpegBin, args...)
+	var output bytes.Buffer
+	cmd.Stderr = &output
 
-	var listContent strings.Builder
-	for _, file := range files {
-		absPath, err := filepath.Abs(file)
+	var stdout io.ReadCloser
+	if progress != nil {
+		pipe, err := cmd.StdoutPipe()
 		if err != nil {
-			return fmt.Errorf("failed to get absolute path for %s: %w", file, err)
+			return plan, fmt.Errorf("failed to attach to ffmpeg progress output: %w", err)
 		}
-		listContent.WriteString(fmt.Sprintf("file '%s'\n", absPath))
+		stdout = pipe
+	} else {
+		cmd.Stdout = &output
 	}
 
-	if err := os.WriteFile(concatListFile, []byte(listContent.String()), 0644); err != nil {
-		return fmt.Errorf("failed to create concat list file: %w", err)
+	if err := cmd.Start(); err != nil {
+		return plan, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	if stdout != nil {
+		readProgress(stdout, progress)
 	}
 
-	args := []string{
-		"-f", "concat",
-		"-safe", "0",
-		"-i", concatListFile,
+	if err := cmd.Wait(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			_ = os.Remove(outputPath)
+			return plan, fmt.Errorf("ffmpeg concat cancelled: %w", ctxErr)
+		}
+		return plan, fmt.Errorf("ffmpeg concat failed: %w\nOutput: %s", err, output.String())
 	}
 
-	switch ext {
-	case ".mp3":
-		args = append(args, "-c", "copy")
-	case ".flac", ".ogg":
-		args = append(args, "-c", "copy")
-	case ".wav", ".wave":
-		args = append(args, "-c", "pcm_s16le")
-	default:
-		args = append(args, "-c", "copy")
+	return plan, nil
+}
+
+// reencodeArgs joins inputs with ffmpeg's concat filter, converting each
+// to the target sample rate and channel layout first.
+func reencodeArgs(inputs []string, target StreamInfo) []string {
+	var args []string
+	var filter strings.Builder
+	for i, input := range inputs {
+		args = append(args, "-i", input)
+		var conversions []string
+		if target.SampleRate > 0 {
+			conversions = append(conversions, fmt.Sprintf("sample_rates=%d", target.SampleRate))
+		}
+		if layout := channelLayout(target.Channels); layout != "" {
+			conversions = append(conversions, "channel_layouts="+layout)
+		}
+		if len(conversions) > 0 {
+			fmt.Fprintf(&filter, "[%d:a]aformat=%s[a%d];", i, strings.Join(conversions, ":"), i)
+		} else {
+			fmt.Fprintf(&filter, "[%d:a]anull[a%d];", i, i)
+		}
 	}
+	for i := range inputs {
+		fmt.Fprintf(&filter, "[a%d]", i)
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=0:a=1[out]", len(inputs))
 
-	args = append(args, outputPath)
+	args = append(args, "-filter_complex", filter.String(), "-map", "[out]")
+	return append(args, encoderArgs(target)...)
+}
 
-	cmd := exec.Command(ffmpegBin, args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("ffmpeg concat failed: %w\nOutput: %s", err, string(output))
+// chapterArgs takes the global tags and chapters of the output from the
+// FFMETADATA file read as input index.
+func chapterArgs(index int) []string {
+	i := strconv.Itoa(index)
+	return []string{"-map_metadata", i, "-map_chapters", i}
+}
+
+func encoderArgs(target StreamInfo) []string {
+	switch target.Codec {
+	case CodecMP3:
+		if target.VBR || target.Bitrate == 0 {
+			return []string{"-c:a", "libmp3lame", "-q:a", "0"}
+		}
+		return []string{"-c:a", "libmp3lame", "-b:a", fmt.Sprintf("%dk", target.Bitrate)}
+	case CodecFLAC:
+		if target.BitsPerSample > 16 {
+			return []string{"-c:a", "flac", "-sample_fmt", "s32", "-bits_per_raw_sample", strconv.Itoa(target.BitsPerSample)}
+		}
+		return []string{"-c:a", "flac", "-sample_fmt", "s16"}
+	case CodecVorbis:
+		if target.Bitrate > 0 {
+			return []string{"-c:a", "libvorbis", "-b:a", fmt.Sprintf("%dk", target.Bitrate)}
+		}
+		return []string{"-c:a", "libvorbis", "-q:a", "6"}
+	case CodecOpus:
+		return []string{"-c:a", "libopus"}
+	case CodecAAC:
+		bitrate := target.Bitrate
+		if bitrate == 0 {
+			bitrate = 192
+		}
+		return []string{"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", bitrate)}
+	default:
+		switch {
+		case target.BitsPerSample > 24:
+			return []string{"-c:a", "pcm_s32le"}
+		case target.BitsPerSample > 16:
+			return []string{"-c:a", "pcm_s24le"}
+		default:
+			return []string{"-c:a", "pcm_s16le"}
+		}
 	}
+}
 
-	return nil
+func channelLayout(channels int) string {
+	layouts := map[int]string{1: "mono", 2: "stereo", 3: "2.1", 4: "quad", 5: "5.0", 6: "5.1", 7: "6.1", 8: "7.1"}
+	return layouts[channels]
+}
+
+// readProgress consumes the key=value stream written by ffmpeg's -progress
+// flag and reports the output size after each update block.
+func readProgress(r io.Reader, progress ProgressFunc) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "total_size" {
+			continue
+		}
+		if written, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			progress(written)
+		}
+	}
+	_, _ = io.Copy(io.Discard, r)
 }
@@ -0,0 +1,80 @@
+package concat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectMultiPartSetsNaturalOrder(t *testing.T) {
+	var files []string
+	for _, n := range []string{"10", "2", "12", "1", "11", "3", "9", "4", "8", "5", "7", "6"} {
+		files = append(files, "Broadcast_Part_"+n+".mp3")
+	}
+
+	sets := DetectMultiPartSets(files)
+	if len(sets) != 1 {
+		t.Fatalf("Expected 1 set, got %+v", sets)
+	}
+
+	set := sets[0]
+	expected := []string{
+		"Broadcast_Part_1.mp3", "Broadcast_Part_2.mp3", "Broadcast_Part_3.mp3", "Broadcast_Part_4.mp3",
+		"Broadcast_Part_5.mp3", "Broadcast_Part_6.mp3", "Broadcast_Part_7.mp3", "Broadcast_Part_8.mp3",
+		"Broadcast_Part_9.mp3", "Broadcast_Part_10.mp3", "Broadcast_Part_11.mp3", "Broadcast_Part_12.mp3",
+	}
+	if !reflect.DeepEqual(set.Files, expected) {
+		t.Errorf("Expected natural order, got %v", set.Files)
+	}
+	if set.OrderedBy != OrderByPartNumber || set.OutputName != "Broadcast.mp3" {
+		t.Errorf("Unexpected set: %+v", set)
+	}
+	for i, part := range set.Parts {
+		if part.Number != i+1 || part.File != expected[i] {
+			t.Errorf("Expected part %d to be %s, got %+v", i+1, expected[i], part)
+		}
+	}
+}
+
+func TestDetectMultiPartSetsMetadataOrder(t *testing.T) {
+	files := []string{"Show-1.flac", "Show-01.flac", "Show-2.flac"}
+	metadata := map[string]TrackInfo{
+		"Show-1.flac":  {Disc: "2/2", Track: "1"},
+		"Show-01.flac": {Disc: "1/2", Track: "01/04"},
+		"Show-2.flac":  {Disc: "2/2", Track: "2"},
+	}
+
+	tests := []struct {
+		name      string
+		metadata  map[string]TrackInfo
+		expected  []string
+		orderedBy string
+	}{
+		{"with metadata", metadata, []string{"Show-01.flac", "Show-1.flac", "Show-2.flac"}, OrderByMetadata},
+		{"without metadata", nil, []string{"Show-01.flac", "Show-1.flac", "Show-2.flac"}, OrderByName},
+		{"metadata disagrees with names", map[string]TrackInfo{
+			"Show-1.flac":  {Track: "1"},
+			"Show-01.flac": {Track: "2"},
+		}, []string{"Show-1.flac", "Show-01.flac", "Show-2.flac"}, OrderByMetadata},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sets := DetectMultiPartSetsWithMetadata(files, tt.metadata)
+			if len(sets) != 1 {
+				t.Fatalf("Expected 1 set, got %+v", sets)
+			}
+			if !reflect.DeepEqual(sets[0].Files, tt.expected) || sets[0].OrderedBy != tt.orderedBy {
+				t.Errorf("Expected %v ordered by %s, got %v ordered by %s", tt.expected, tt.orderedBy, sets[0].Files, sets[0].OrderedBy)
+			}
+		})
+	}
+}
+
+func TestLeadingNumber(t *testing.T) {
+	tests := map[string]int{"3": 3, "03/12": 3, " 2/2": 2, "": 0, "A": 0, "B2": 0}
+	for value, expected := range tests {
+		if got := leadingNumber(value); got != expected {
+			t.Errorf("leadingNumber(%q): expected %d, got %d", value, expected, got)
+		}
+	}
+}
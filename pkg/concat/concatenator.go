@@ -0,0 +1,191 @@
+package concat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	BackendAuto   = "auto"
+	BackendFFMPEG = "ffmpeg"
+	BackendNative = "native"
+
+	outputBufferSize = 64 << 10
+)
+
+var ErrNotJoinable = errors.New("parts cannot be joined without ffmpeg")
+
+type (
+	// Concatenator joins the parts of a multi-part set into one file and
+	// reports how it did so. Chapterize also marks each part as a chapter.
+	Concatenator interface {
+		Name() string
+		Concatenate(ctx context.Context, files []string, outputPath string, progress ProgressFunc) (Plan, error)
+		Chapterize(ctx context.Context, files []string, outputPath string, chapters ChapterList, progress ProgressFunc) (Plan, error)
+	}
+	// FFMPEGConcatenator joins any format ffmpeg reads, re-encoding parts
+	// whose stream parameters differ.
+	FFMPEGConcatenator struct {
+		Binary string
+	}
+	// NativeConcatenator joins WAV, MP3 and FLAC parts in Go, without
+	// re-encoding. The parts must share their sample rate, channel count and
+	// bit depth.
+	NativeConcatenator struct{}
+)
+
+// NewConcatenator returns the concatenator for backend. BackendAuto, or an
+// empty backend, uses ffmpeg when ffmpegBin runs and the native joiner
+// otherwise.
+func NewConcatenator(backend, ffmpegBin string) (Concatenator, error) {
+	switch backend {
+	case BackendAuto, "":
+		if CheckFFMPEG(ffmpegBin) == nil {
+			return FFMPEGConcatenator{Binary: ffmpegBin}, nil
+		}
+		return NativeConcatenator{}, nil
+	case BackendFFMPEG:
+		if err := CheckFFMPEG(ffmpegBin); err != nil {
+			return nil, err
+		}
+		return FFMPEGConcatenator{Binary: ffmpegBin}, nil
+	case BackendNative:
+		return NativeConcatenator{}, nil
+	}
+	return nil, fmt.Errorf("unknown concatenation backend %q", backend)
+}
+
+func ValidBackend(backend string) bool {
+	switch backend {
+	case BackendAuto, BackendFFMPEG, BackendNative, "":
+		return true
+	}
+	return false
+}
+
+func (FFMPEGConcatenator) Name() string {
+	return BackendFFMPEG
+}
+
+func (c FFMPEGConcatenator) Concatenate(ctx context.Context, files []string, outputPath string, progress ProgressFunc) (Plan, error) {
+	return ConcatenateFilesContext(ctx, c.Binary, files, outputPath, progress)
+}
+
+func (c FFMPEGConcatenator) Chapterize(ctx context.Context, files []string, outputPath string, chapters ChapterList, progress ProgressFunc) (Plan, error) {
+	return ChapterizeContext(ctx, c.Binary, files, outputPath, chapters, progress)
+}
+
+func (NativeConcatenator) Name() string {
+	return BackendNative
+}
+
+func (NativeConcatenator) Concatenate(ctx context.Context, files []string, outputPath string, progress ProgressFunc) (Plan, error) {
+	if len(files) == 0 {
+		return Plan{}, fmt.Errorf("no files to concatenate")
+	}
+
+	inputs := make([]StreamInfo, 0, len(files))
+	for _, file := range files {
+		info, err := ProbeFile(file)
+		if err != nil {
+			return Plan{}, fmt.Errorf("%w: %v", ErrNotJoinable, err)
+		}
+		inputs = append(inputs, info)
+	}
+
+	codec := inputs[0].Codec
+	if codec != CodecPCM && codec != CodecMP3 && codec != CodecFLAC {
+		return Plan{}, fmt.Errorf("%w: only WAV, MP3 and FLAC are supported, not %s", ErrNotJoinable, codec)
+	}
+	if outputCodec := codecForExt(filepath.Ext(outputPath)); outputCodec != codec {
+		return Plan{}, fmt.Errorf("%w: %s parts cannot be written to %s", ErrNotJoinable, codec, filepath.Base(outputPath))
+	}
+	// MP3 frames carry their own bitrate, so only the other parameters
+	// have to agree.
+	if differences := mismatches(inputs, codec == CodecMP3); len(differences) > 0 {
+		return Plan{}, fmt.Errorf("%w: %s", ErrNotJoinable, differences[0])
+	}
+
+	plan := Plan{Path: PathCopy, Backend: BackendNative, Target: inputs[0], Inputs: inputs}
+	for _, info := range inputs[1:] {
+		if info.VBR || info.Bitrate != plan.Target.Bitrate {
+			plan.Target.VBR, plan.Target.Bitrate = true, 0
+		}
+	}
+	plan.Reason = "all parts are " + plan.Target.String()
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return plan, fmt.Errorf("failed to create %s: %w", outputPath, err)
+	}
+	out := &outputWriter{ctx: ctx, file: f, progress: progress}
+	out.buf = bufio.NewWriterSize(out, outputBufferSize)
+
+	switch codec {
+	case CodecPCM:
+		err = joinWAV(out, files)
+	case CodecMP3:
+		err = joinMP3(out, files)
+	case CodecFLAC:
+		err = joinFLAC(out, files)
+	}
+	if err == nil {
+		err = out.buf.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(outputPath)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return plan, fmt.Errorf("concat cancelled: %w", ctxErr)
+		}
+		return plan, fmt.Errorf("concat failed: %w", err)
+	}
+	return plan, nil
+}
+
+func (NativeConcatenator) Chapterize(context.Context, []string, string, ChapterList, ProgressFunc) (Plan, error) {
+	return Plan{}, fmt.Errorf("%w: chapterized M4B and MKA files are only written by ffmpeg", ErrNotJoinable)
+}
+
+// outputWriter counts the bytes written to the joined file, reporting
+// progress as its buffer is flushed and stopping once ctx is cancelled.
+type outputWriter struct {
+	ctx      context.Context
+	file     *os.File
+	buf      *bufio.Writer
+	written  int64
+	progress ProgressFunc
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	if w.progress != nil {
+		w.progress(w.written)
+	}
+	return n, err
+}
+
+// offset is the position in the joined file of the next byte written.
+func (w *outputWriter) offset() int64 {
+	return w.written + int64(w.buf.Buffered())
+}
+
+// patch overwrites already written bytes at offset, once the buffer has
+// been flushed, to fill in headers whose values are only known at the end.
+func (w *outputWriter) patch(offset int64, data []byte) error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	_, err := w.file.WriteAt(data, offset)
+	return err
+}
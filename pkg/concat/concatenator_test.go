@@ -0,0 +1,219 @@
+package concat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// flacFrame builds a frame header for a stereo 16-bit 44.1 kHz stream with
+// the given frame number and block size code, followed by body. A code of 6
+// takes the block size from an extra byte.
+func flacFrame(number uint64, blockCode byte, blockSize int, body []byte) []byte {
+	frame := []byte{0xff, 0xf8, blockCode<<4 | 0x9, 0x1<<4 | 0x4<<1}
+	frame = append(frame, encodeFLACNumber(number)...)
+	if blockCode == 6 {
+		frame = append(frame, byte(blockSize-1))
+	}
+	frame = append(frame, flacCRC8(frame))
+	frame = append(frame, body...)
+	crc := flacCRC16(frame)
+	return append(frame, byte(crc>>8), byte(crc))
+}
+
+func writeParts(t *testing.T, dir string, parts map[string][]byte) {
+	t.Helper()
+	for name, data := range parts {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func joinNative(t *testing.T, dir string, output string, files ...string) Plan {
+	t.Helper()
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, filepath.Join(dir, file))
+	}
+	plan, err := NativeConcatenator{}.Concatenate(context.Background(), paths, filepath.Join(dir, output), nil)
+	if err != nil {
+		t.Fatalf("Concatenate failed: %v", err)
+	}
+	if plan.Backend != BackendNative || plan.Path != PathCopy {
+		t.Errorf("Expected a native copy plan, got %+v", plan)
+	}
+	return plan
+}
+
+func TestNativeConcatenateWAV(t *testing.T) {
+	dir := t.TempDir()
+	writeParts(t, dir, map[string][]byte{
+		"a.wav":     wavFile(44100, 2, 16, []byte{1, 2, 3, 4, 5, 6, 7, 8}),
+		"b.wav":     wavFile(44100, 2, 16, []byte{9, 10, 11, 12}),
+		"hires.wav": wavFile(96000, 2, 24, make([]byte, 6)),
+	})
+
+	joinNative(t, dir, "out.wav", "a.wav", "b.wav")
+	got, err := os.ReadFile(filepath.Join(dir, "out.wav"))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if expected := wavFile(44100, 2, 16, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}); !bytes.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	_, err = NativeConcatenator{}.Concatenate(context.Background(),
+		[]string{filepath.Join(dir, "a.wav"), filepath.Join(dir, "hires.wav")}, filepath.Join(dir, "mixed.wav"), nil)
+	if !errors.Is(err, ErrNotJoinable) {
+		t.Errorf("Expected ErrNotJoinable for mismatched parts, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mixed.wav")); !os.IsNotExist(err) {
+		t.Errorf("Expected no output for mismatched parts, got %v", err)
+	}
+}
+
+func TestNativeConcatenateMP3(t *testing.T) {
+	tag := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x04"), 'T', 'I', 'T', '2')
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+
+	dir := t.TempDir()
+	writeParts(t, dir, map[string][]byte{
+		"a.mp3": append(tag, mp3Frames(false, true, 9, 9, 9, 9)...),
+		"b.mp3": append(append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), mp3Frames(false, false, 11, 11)...), id3v1...),
+	})
+
+	plan := joinNative(t, dir, "out.mp3", "a.mp3", "b.mp3")
+	if !plan.Target.VBR {
+		t.Errorf("Expected a VBR target for mixed bitrates, got %+v", plan.Target)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "out.mp3"))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if !bytes.HasPrefix(got, tag) {
+		t.Fatalf("Expected the first part's ID3 tag to be kept")
+	}
+
+	offset := len(tag)
+	header, ok := parseMP3Frame(got[offset:])
+	if !ok || !isMP3InfoFrame(header, got[offset:offset+header.length]) {
+		t.Fatalf("Expected a Xing frame after the tag")
+	}
+	xing := got[offset+4+header.sideInfoSize():]
+	if string(xing[:4]) != "Xing" || xing[11] != 5 {
+		t.Errorf("Expected a Xing header counting 5 frames, got %q", xing[:12])
+	}
+
+	var bitrates []int
+	for offset += header.length; offset < len(got); {
+		frame, ok := parseMP3Frame(got[offset:])
+		if !ok {
+			t.Fatalf("Expected a frame at %d of %d", offset, len(got))
+		}
+		bitrates = append(bitrates, frame.bitrate)
+		offset += frame.length
+	}
+	if expected := []int{128, 128, 128, 192, 192}; !slices.Equal(bitrates, expected) {
+		t.Errorf("Expected frames at %v, got %v", expected, bitrates)
+	}
+}
+
+func TestNativeConcatenateFLAC(t *testing.T) {
+	seekTable := append([]byte{flacSeekTable, 0, 0, 18}, make([]byte, 18)...)
+	comment := append([]byte{0x84, 0, 0, 8}, "comments"...)
+	a := flacFile(44100, 2, 16, 356, nil)
+	a[4] = flacStreamInfo
+	a = append(append(append(a, seekTable...), comment...),
+		append(flacFrame(0, 8, 256, []byte("first")), flacFrame(1, 6, 100, []byte("second"))...)...)
+	b := flacFile(44100, 2, 16, 562, nil)
+	b = append(b, flacFrame(0, 8, 256, []byte("third"))...)
+	b = append(b, flacFrame(1, 8, 256, []byte{0xff, 0xf8, 0x00})...)
+	b = append(b, flacFrame(2, 6, 50, []byte("fifth"))...)
+
+	dir := t.TempDir()
+	writeParts(t, dir, map[string][]byte{"a.flac": a, "b.flac": b})
+	joinNative(t, dir, "out.flac", "a.flac", "b.flac")
+
+	f, err := os.Open(filepath.Join(dir, "out.flac"))
+	if err != nil {
+		t.Fatalf("Failed to open output: %v", err)
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+
+	blocks, err := readFLACMetadata(f)
+	if err != nil {
+		t.Fatalf("Failed to read output metadata: %v", err)
+	}
+	if len(blocks) != 2 || blocks[1][0] != 0x84 {
+		t.Errorf("Expected STREAMINFO and the comment block, got %d blocks", len(blocks))
+	}
+	info, err := probe(append([]byte("fLaC"), blocks[0]...))
+	if err != nil || info.SampleRate != 44100 || info.Channels != 2 || info.BitsPerSample != 16 {
+		t.Errorf("Unexpected stream parameters %+v: %v", info, err)
+	}
+	streamInfo := blocks[0][4:]
+	if minBlock, maxBlock := int(streamInfo[0])<<8|int(streamInfo[1]), int(streamInfo[2])<<8|int(streamInfo[3]); minBlock != 100 || maxBlock != 256 {
+		t.Errorf("Expected block sizes 100 to 256, got %d to %d", minBlock, maxBlock)
+	}
+	if samples := streamInfo[17]; samples != 918&0xff {
+		t.Errorf("Expected 918 samples, got low byte %d", samples)
+	}
+
+	frames := &flacFrameReader{r: f}
+	var sample uint64
+	bodies := []string{"first", "second", "third", "\xff\xf8\x00", "fifth"}
+	for i, body := range bodies {
+		header, frame, err := frames.next()
+		if err != nil {
+			t.Fatalf("Failed to read frame %d: %v", i, err)
+		}
+		if frame[1]&0x01 == 0 || !bytes.Equal(frame[4:header.numberEnd], encodeFLACNumber(sample)) {
+			t.Errorf("Expected frame %d to start at sample %d, got %x", i, sample, frame[:header.size])
+		}
+		if got := string(frame[header.size : len(frame)-2]); got != body {
+			t.Errorf("Expected frame %d to hold %q, got %q", i, body, got)
+		}
+		sample += uint64(header.blockSize)
+	}
+	if _, _, err := frames.next(); err == nil {
+		t.Error("Expected no frames after the last part")
+	}
+}
+
+func TestEncodeFLACNumber(t *testing.T) {
+	tests := []struct {
+		n        uint64
+		expected []byte
+	}{
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0xc2, 0x80}},
+		{0x10000, []byte{0xf0, 0x90, 0x80, 0x80}},
+		{1 << 35, []byte{0xfe, 0xa0, 0x80, 0x80, 0x80, 0x80, 0x80}},
+	}
+	for _, tt := range tests {
+		if got := encodeFLACNumber(tt.n); !bytes.Equal(got, tt.expected) {
+			t.Errorf("Expected %x for %d, got %x", tt.expected, tt.n, got)
+		}
+	}
+}
+
+func TestNewConcatenator(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "ffmpeg-missing")
+
+	concatenator, err := NewConcatenator(BackendAuto, missing)
+	if err != nil || concatenator.Name() != BackendNative {
+		t.Errorf("Expected the native backend without ffmpeg, got %v, %v", concatenator, err)
+	}
+	if _, err := NewConcatenator(BackendFFMPEG, missing); err == nil {
+		t.Error("Expected an error when ffmpeg is required but missing")
+	}
+	if _, err := NewConcatenator("sox", missing); err == nil {
+		t.Error("Expected an error for an unknown backend")
+	}
+}
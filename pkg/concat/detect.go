@@ -0,0 +1,399 @@
+package concat
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type (
+	MultiPartSet struct {
+		BasePattern string
+		// Files holds the parts in the order they are concatenated.
+		Files      []string
+		OutputName string
+		// OrderedBy says what decided the order of Files: "part number",
+		// "track metadata" when part numbers repeat, or "name".
+		OrderedBy string
+		Parts     []Part
+		// Pattern names the PartPattern the files matched, and Score and
+		// Evidence explain why they were taken for one split recording.
+		Pattern  string
+		Score    float64
+		Evidence []string
+	}
+	Part struct {
+		File   string
+		Number int
+		Disc   int `json:",omitempty"`
+		Track  int `json:",omitempty"`
+		// disc comes from the file name and orders parts before Number.
+		disc int
+	}
+	// TrackInfo carries the per-file metadata archive.org publishes, such as
+	// a disc of "1/2" and a track of "03/12".
+	TrackInfo struct {
+		Disc  string
+		Track string
+		Title string
+	}
+	// PartPattern recognises one way of numbering parts in file names. The
+	// regexp is matched against the name without its extension and must
+	// capture the part number in a group named part, side (A, B, ... or a
+	// number) or disc. A disc group alongside part or side numbers discs of
+	// tracks, and a group named title captures per-file title text. The
+	// matched text is removed from the name to group parts into sets.
+	PartPattern struct {
+		Name   string
+		Regexp *regexp.Regexp
+		// Weight is how strongly a match suggests one recording split into
+		// parts rather than an album of separate tracks.
+		Weight float64
+	}
+	// Detector groups downloaded files into sets of parts. Each candidate
+	// set is scored from the pattern it matched, how its numbers run and
+	// what its titles say, and only sets reaching MinScore are returned.
+	Detector struct {
+		Patterns []PartPattern
+		// MinScore of zero means DefaultMinScore; a negative MinScore keeps
+		// every set whatever its score.
+		MinScore float64
+		// TitlesAsChapters stops distinct titles counting against a set,
+		// for output that keeps them as chapter names.
+		TitlesAsChapters bool
+	}
+)
+
+const (
+	OrderByPartNumber = "part number"
+	OrderByMetadata   = "track metadata"
+	OrderByName       = "name"
+
+	DefaultMinScore = 1.0
+
+	customPatternWeight  = 1.0
+	sequenceBonus        = 0.3
+	gapPenalty           = 0.2
+	duplicatePenalty     = 0.3
+	sameTitleBonus       = 0.3
+	distinctTitlePenalty = 1.0
+)
+
+// DefaultPartPatterns returns the built-in patterns, most specific first.
+func DefaultPartPatterns() []PartPattern {
+	return []PartPattern{
+		{"part", regexp.MustCompile(`(?i)(?:^|[ _.-])(?:part|pt)[ _.-]?(?P<part>\d+)`), 1.0},
+		{"side", regexp.MustCompile(`(?i)(?:^|[ _.-])side[ _.-]?(?P<side>[a-h]|\d{1,2})(?:$|[ _.-])`), 1.0},
+		{"disc-directory", regexp.MustCompile(`(?i)(?:^|/)(?:cd|disc|disk)[ _-]?(?P<disc>\d+)/(?:track[ _-]?)?(?P<part>\d+)(?P<title>(?:[ _.-].*)?)$`), 0.8},
+		{"disc-track", regexp.MustCompile(`(?i)(?:^|[ _.-])(?:cd|disc|disk)[ _.-]?(?P<disc>\d+)[ _.-]+(?:track[ _.-]?)?(?P<part>\d+)(?P<title>(?:[ _.-].*)?)$`), 0.8},
+		{"etree", regexp.MustCompile(`(?i)d(?P<disc>\d{1,2})t(?P<part>\d{1,3})(?P<title>(?:[ _.-].*)?)$`), 0.8},
+		{"disc", regexp.MustCompile(`(?i)(?:^|[ _.-])(?:cd|disc|disk)[ _.-]?(?P<disc>\d+)$`), 1.0},
+		{"parenthesized", regexp.MustCompile(`[ _]?\((?P<part>\d+)\)`), 0.6},
+		{"trailing-number", regexp.MustCompile(`[ _-](?P<part>\d+)$`), 0.5},
+	}
+}
+
+// ParsePartPatterns compiles user-supplied regexps into patterns. Each must
+// have a part, side or disc group, as described on PartPattern.
+func ParsePartPatterns(specs []string) ([]PartPattern, error) {
+	var patterns []PartPattern
+	for i, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		re, err := regexp.Compile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("part pattern %q: %w", spec, err)
+		}
+		if re.SubexpIndex("part") < 0 && re.SubexpIndex("side") < 0 && re.SubexpIndex("disc") < 0 {
+			return nil, fmt.Errorf("part pattern %q has no part, side or disc group", spec)
+		}
+		patterns = append(patterns, PartPattern{Name: fmt.Sprintf("custom-%d", i+1), Regexp: re, Weight: customPatternWeight})
+	}
+	return patterns, nil
+}
+
+func DefaultDetector() *Detector {
+	return &Detector{Patterns: DefaultPartPatterns(), MinScore: DefaultMinScore}
+}
+
+// DetectMultiPartSets groups and orders files by the default patterns
+// without scoring them, so album tracks that happen to be numbered are
+// grouped too. Use a Detector to keep only likely split recordings.
+func DetectMultiPartSets(files []string) []MultiPartSet {
+	return DetectMultiPartSetsWithMetadata(files, nil)
+}
+
+func DetectMultiPartSetsWithMetadata(files []string, metadata map[string]TrackInfo) []MultiPartSet {
+	detector := Detector{Patterns: DefaultPartPatterns(), MinScore: math.Inf(-1)}
+	return detector.Detect(files, metadata)
+}
+
+// Detect groups files, keyed in metadata by name, into sets of parts. Parts
+// are ordered by disc and part number from their names, so Part_2 comes
+// before Part_10; parts sharing a number are ordered by the disc and track
+// in metadata, and then by name.
+func (d *Detector) Detect(files []string, metadata map[string]TrackInfo) []MultiPartSet {
+	type candidate struct {
+		set     *MultiPartSet
+		pattern PartPattern
+		titles  []string
+	}
+	candidates := make(map[string]*candidate)
+	var keys []string
+
+	for _, file := range files {
+		ext := path.Ext(file)
+		baseName := strings.TrimSuffix(file, ext)
+
+		for _, pattern := range d.Patterns {
+			match := pattern.Regexp.FindStringSubmatchIndex(baseName)
+			if match == nil {
+				continue
+			}
+			part, ok := matchPart(pattern.Regexp, baseName, match)
+			if !ok {
+				continue
+			}
+
+			basePattern := removeMatch(baseName, match[0], match[1])
+			key := pattern.Name + "\x00" + basePattern + ext
+			c, exists := candidates[key]
+			if !exists {
+				c = &candidate{
+					set:     &MultiPartSet{BasePattern: basePattern, OutputName: outputName(basePattern, ext), Pattern: pattern.Name},
+					pattern: pattern,
+				}
+				candidates[key] = c
+				keys = append(keys, key)
+			}
+
+			info := metadata[file]
+			part.File = file
+			if part.Disc == 0 {
+				part.Disc = leadingNumber(info.Disc)
+			}
+			part.Track = leadingNumber(info.Track)
+			c.set.Parts = append(c.set.Parts, part)
+
+			title := info.Title
+			if i := pattern.Regexp.SubexpIndex("title"); title == "" && i >= 0 && match[2*i] >= 0 {
+				title = baseName[match[2*i]:match[2*i+1]]
+			}
+			c.titles = append(c.titles, title)
+			break
+		}
+	}
+
+	minScore := d.MinScore
+	if minScore == 0 {
+		minScore = DefaultMinScore
+	}
+
+	var result []MultiPartSet
+	for _, key := range keys {
+		c := candidates[key]
+		set := c.set
+		if len(set.Parts) < 2 {
+			continue
+		}
+		set.OrderedBy = orderParts(set.Parts)
+		set.Score, set.Evidence = score(c.pattern, set.Parts, set.OrderedBy, c.titles, d.TitlesAsChapters)
+		if set.Score < minScore {
+			continue
+		}
+		for _, part := range set.Parts {
+			set.Files = append(set.Files, part.File)
+		}
+		result = append(result, *set)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].OutputName < result[j].OutputName })
+
+	return result
+}
+
+// matchPart reads the part and disc numbers out of a match.
+func matchPart(re *regexp.Regexp, name string, match []int) (Part, bool) {
+	capture := func(group string) (string, bool) {
+		i := re.SubexpIndex(group)
+		if i < 0 || match[2*i] < 0 {
+			return "", false
+		}
+		return name[match[2*i]:match[2*i+1]], true
+	}
+
+	disc, hasDisc := capture("disc")
+	if value, ok := capture("part"); ok {
+		number, err := strconv.Atoi(value)
+		return Part{Number: number, Disc: leadingNumber(disc), disc: leadingNumber(disc)}, err == nil
+	}
+	if value, ok := capture("side"); ok {
+		number := sideNumber(value)
+		return Part{Number: number, Disc: leadingNumber(disc), disc: leadingNumber(disc)}, number > 0
+	}
+	if hasDisc {
+		number, err := strconv.Atoi(disc)
+		return Part{Number: number}, err == nil
+	}
+	return Part{}, false
+}
+
+// sideNumber numbers sides A, B, ... from 1, and reads numeric sides as is.
+func sideNumber(side string) int {
+	if number, err := strconv.Atoi(side); err == nil {
+		return number
+	}
+	if len(side) == 1 && unicode.IsLetter(rune(side[0])) {
+		return int(unicode.ToLower(rune(side[0]))-'a') + 1
+	}
+	return 0
+}
+
+// removeMatch cuts name[start:end] out of name. A separator ending the match
+// is kept when text follows, so "Album_Side_A_Live" becomes "Album_Live".
+func removeMatch(name string, start, end int) string {
+	before, after := name[:start], name[end:]
+	if after != "" && end > start && isSeparator(name[end-1]) {
+		after = name[end-1:]
+	}
+	return strings.TrimRight(before, " _.-") + after
+}
+
+func outputName(basePattern, ext string) string {
+	dir, base := path.Split(basePattern)
+	if strings.Trim(base, " _.-") == "" {
+		base = "combined"
+	}
+	return dir + base + ext
+}
+
+func isSeparator(c byte) bool {
+	return strings.IndexByte(" _.-", c) >= 0
+}
+
+// orderParts sorts parts and reports which key settled their order.
+func orderParts(parts []Part) string {
+	sort.SliceStable(parts, func(i, j int) bool {
+		a, b := parts[i], parts[j]
+		switch {
+		case a.disc != b.disc:
+			return a.disc < b.disc
+		case a.Number != b.Number:
+			return a.Number < b.Number
+		case a.Disc != b.Disc:
+			return a.Disc < b.Disc
+		case a.Track != b.Track:
+			return a.Track < b.Track
+		default:
+			return a.File < b.File
+		}
+	})
+
+	orderedBy := OrderByPartNumber
+	for i := 1; i < len(parts); i++ {
+		a, b := parts[i-1], parts[i]
+		if a.disc != b.disc || a.Number != b.Number {
+			continue
+		}
+		if a.Disc == b.Disc && a.Track == b.Track {
+			return OrderByName
+		}
+		orderedBy = OrderByMetadata
+	}
+	return orderedBy
+}
+
+// score weighs the evidence that sorted parts are one recording split up,
+// rather than an album of separate tracks that happen to be numbered.
+func score(pattern PartPattern, parts []Part, orderedBy string, titles []string, titlesAsChapters bool) (float64, []string) {
+	total := pattern.Weight
+	evidence := []string{fmt.Sprintf("names match the %s pattern", pattern.Name)}
+
+	switch {
+	case orderedBy != OrderByPartNumber:
+		total -= duplicatePenalty
+		evidence = append(evidence, "part numbers repeat")
+	case sequential(parts):
+		total += sequenceBonus
+		evidence = append(evidence, "parts are numbered without gaps")
+	default:
+		total -= gapPenalty
+		evidence = append(evidence, "part numbers have gaps")
+	}
+
+	distinct := map[string]bool{}
+	for _, title := range titles {
+		if normalized := normalizeTitle(title); normalized != "" {
+			distinct[normalized] = true
+		}
+	}
+	switch {
+	case len(distinct) > 1 && titlesAsChapters:
+		evidence = append(evidence, "files have distinct titles, kept as chapter names")
+	case len(distinct) > 1:
+		total -= distinctTitlePenalty
+		evidence = append(evidence, "files have distinct titles, like album tracks")
+	case len(distinct) == 1:
+		total += sameTitleBonus
+		evidence = append(evidence, "files share a title")
+	}
+
+	return math.Round(total*100) / 100, evidence
+}
+
+// sequential reports whether the part numbers on each disc run from 0 or 1
+// without gaps or repeats.
+func sequential(parts []Part) bool {
+	next := -1
+	disc := -1
+	for _, part := range parts {
+		if part.disc != disc {
+			if part.Number > 1 {
+				return false
+			}
+			disc, next = part.disc, part.Number+1
+			continue
+		}
+		if part.Number != next {
+			return false
+		}
+		next++
+	}
+	return true
+}
+
+var titleNoise = map[string]bool{"part": true, "pt": true, "side": true, "disc": true, "disk": true, "cd": true, "track": true, "of": true}
+
+// normalizeTitle reduces a title to its words, dropping numbers, single
+// letters and words like "part" that number the parts themselves.
+func normalizeTitle(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool { return !unicode.IsLetter(r) })
+	kept := words[:0]
+	for _, word := range words {
+		if len(word) > 1 && !titleNoise[word] {
+			kept = append(kept, word)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// leadingNumber reads the number at the start of a disc or track field,
+// returning 0 when there is none.
+func leadingNumber(value string) int {
+	value = strings.TrimSpace(value)
+	end := 0
+	for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(value[:end])
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,221 @@
+package concat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectorRepeatedPartNumbers(t *testing.T) {
+	files := []string{"Show_Part_1.flac", "Show_Part_01.flac", "Show_Part_2.flac"}
+
+	// Without metadata nothing tells the repeated part numbers apart, so
+	// the files are not taken for one recording.
+	if sets := DefaultDetector().Detect(files, nil); len(sets) != 0 {
+		t.Errorf("Expected no sets for ambiguous part numbers, got %+v", sets)
+	}
+	if sets := DefaultDetector().Detect([]string{"Show-1.flac", "Show-01.flac", "Show-2.flac"}, nil); len(sets) != 0 {
+		t.Errorf("Expected no sets for duplicate copies, got %+v", sets)
+	}
+
+	// The unscored grouping still orders them.
+	if sets := DetectMultiPartSets(files); len(sets) != 1 || sets[0].OrderedBy != OrderByName {
+		t.Errorf("Expected one set ordered by name, got %+v", sets)
+	}
+}
+
+func TestDetectorTitlesAsChapters(t *testing.T) {
+	files := []string{"Serial_Part_1.mp3", "Serial_Part_2.mp3", "Serial_Part_3.mp3"}
+	metadata := map[string]TrackInfo{
+		"Serial_Part_1.mp3": {Title: "The Hidden Valley"},
+		"Serial_Part_2.mp3": {Title: "Trail of Ambush"},
+		"Serial_Part_3.mp3": {Title: "The Last Stand"},
+	}
+
+	detector := DefaultDetector()
+	if sets := detector.Detect(files, metadata); len(sets) != 0 {
+		t.Errorf("Expected distinct titles to read as album tracks, got %+v", sets)
+	}
+
+	detector.TitlesAsChapters = true
+	sets := detector.Detect(files, metadata)
+	if len(sets) != 1 || len(sets[0].Files) != 3 {
+		t.Fatalf("Expected one set of chapters, got %+v", sets)
+	}
+}
+
+// TestDetectorCorpus runs the detector over file listings laid out the way
+// common kinds of archive.org items are.
+func TestDetectorCorpus(t *testing.T) {
+	type expectedSet struct {
+		output  string
+		pattern string
+		files   []string
+	}
+	tests := []struct {
+		name     string
+		files    []string
+		metadata map[string]TrackInfo
+		expected []expectedSet
+	}{
+		{
+			name: "radio broadcast in unpadded parts",
+			files: []string{
+				"WJSV_1939-09-21_Part_10.mp3", "WJSV_1939-09-21_Part_9.mp3", "WJSV_1939-09-21_Part_8.mp3",
+				"WJSV_1939-09-21_Part_7.mp3", "WJSV_1939-09-21_Part_6.mp3", "WJSV_1939-09-21_Part_5.mp3",
+				"WJSV_1939-09-21_Part_4.mp3", "WJSV_1939-09-21_Part_3.mp3", "WJSV_1939-09-21_Part_2.mp3",
+				"WJSV_1939-09-21_Part_1.mp3", "WJSV_1939-09-21.xml",
+			},
+			expected: []expectedSet{{"WJSV_1939-09-21.mp3", "part", []string{
+				"WJSV_1939-09-21_Part_1.mp3", "WJSV_1939-09-21_Part_2.mp3", "WJSV_1939-09-21_Part_3.mp3",
+				"WJSV_1939-09-21_Part_4.mp3", "WJSV_1939-09-21_Part_5.mp3", "WJSV_1939-09-21_Part_6.mp3",
+				"WJSV_1939-09-21_Part_7.mp3", "WJSV_1939-09-21_Part_8.mp3", "WJSV_1939-09-21_Part_9.mp3",
+				"WJSV_1939-09-21_Part_10.mp3",
+			}}},
+		},
+		{
+			name:  "broadcast with a missing part",
+			files: []string{"WJSV_1939-09-21_Part_1.mp3", "WJSV_1939-09-21_Part_2.mp3", "WJSV_1939-09-21_Part_4.mp3"},
+		},
+		{
+			name:  "lecture with part numbers in flac and mp3",
+			files: []string{"Lecture Pt 2.mp3", "Lecture Pt 1.flac", "Lecture Pt 1.mp3", "Lecture Pt 2.flac"},
+			expected: []expectedSet{
+				{"Lecture.flac", "part", []string{"Lecture Pt 1.flac", "Lecture Pt 2.flac"}},
+				{"Lecture.mp3", "part", []string{"Lecture Pt 1.mp3", "Lecture Pt 2.mp3"}},
+			},
+		},
+		{
+			name: "etree concert across two discs",
+			files: []string{
+				"gd1977-05-08d2t01.flac", "gd1977-05-08d1t02.flac", "gd1977-05-08d1t01.flac",
+				"gd1977-05-08d2t02.flac", "gd1977-05-08d1t03.flac", "gd1977-05-08.txt",
+			},
+			expected: []expectedSet{{"gd1977-05-08.flac", "etree", []string{
+				"gd1977-05-08d1t01.flac", "gd1977-05-08d1t02.flac", "gd1977-05-08d1t03.flac",
+				"gd1977-05-08d2t01.flac", "gd1977-05-08d2t02.flac",
+			}}},
+		},
+		{
+			name:  "etree concert with song titles",
+			files: []string{"gd1977-05-08d1t01.flac", "gd1977-05-08d1t02.flac", "gd1977-05-08d1t03.flac"},
+			metadata: map[string]TrackInfo{
+				"gd1977-05-08d1t01.flac": {Title: "New Minglewood Blues"},
+				"gd1977-05-08d1t02.flac": {Title: "Loser"},
+				"gd1977-05-08d1t03.flac": {Title: "El Paso"},
+			},
+		},
+		{
+			name:  "LP transferred by side",
+			files: []string{"Sunday_Serenade_Side_B.flac", "Sunday_Serenade_Side_A.flac", "Sunday_Serenade_Side_A.png"},
+			expected: []expectedSet{{"Sunday_Serenade.flac", "side", []string{
+				"Sunday_Serenade_Side_A.flac", "Sunday_Serenade_Side_B.flac",
+			}}},
+		},
+		{
+			name:  "cassette sides with a suffix",
+			files: []string{"Interview - Side 2 - 1983.mp3", "Interview - Side 1 - 1983.mp3"},
+			expected: []expectedSet{{"Interview - 1983.mp3", "side", []string{
+				"Interview - Side 1 - 1983.mp3", "Interview - Side 2 - 1983.mp3",
+			}}},
+		},
+		{
+			name: "audiobook ripped from CDs",
+			files: []string{
+				"CD2 - 01 Chapter 3.mp3", "CD1 - 02 Chapter 2.mp3", "CD1 - 01 Chapter 1.mp3",
+			},
+			expected: []expectedSet{{"combined.mp3", "disc-track", []string{
+				"CD1 - 01 Chapter 1.mp3", "CD1 - 02 Chapter 2.mp3", "CD2 - 01 Chapter 3.mp3",
+			}}},
+		},
+		{
+			name:  "album ripped from a CD",
+			files: []string{"CD1 - 01 Intro.mp3", "CD1 - 02 Blue Skies.mp3", "CD1 - 03 Finale.mp3"},
+		},
+		{
+			name:  "78rpm record split by disc",
+			files: []string{"78_in-the-mood_glenn-miller_disc2.flac", "78_in-the-mood_glenn-miller_disc1.flac"},
+			expected: []expectedSet{{"78_in-the-mood_glenn-miller.flac", "disc", []string{
+				"78_in-the-mood_glenn-miller_disc1.flac", "78_in-the-mood_glenn-miller_disc2.flac",
+			}}},
+		},
+		{
+			name:  "disc directories",
+			files: []string{"disc2/track01.flac", "disc1/track02.flac", "disc1/track01.flac"},
+			expected: []expectedSet{{"combined.flac", "disc-directory", []string{
+				"disc1/track01.flac", "disc1/track02.flac", "disc2/track01.flac",
+			}}},
+		},
+		{
+			name:  "album tracks ending in numbers",
+			files: []string{"Song_01.mp3", "Song_02.mp3", "Song_03.mp3"},
+		},
+		{
+			name:  "album tracks with titles",
+			files: []string{"Song_01.mp3", "Song_02.mp3", "Song_03.mp3"},
+			metadata: map[string]TrackInfo{
+				"Song_01.mp3": {Title: "Morning", Track: "1"},
+				"Song_02.mp3": {Title: "Evening", Track: "2"},
+				"Song_03.mp3": {Title: "Night", Track: "3"},
+			},
+		},
+		{
+			name:  "numbered episode segments with a shared title",
+			files: []string{"Suspense-1942-06-17-02.mp3", "Suspense-1942-06-17-01.mp3"},
+			metadata: map[string]TrackInfo{
+				"Suspense-1942-06-17-01.mp3": {Title: "Cabin by the Lake (1)"},
+				"Suspense-1942-06-17-02.mp3": {Title: "Cabin by the Lake (2)"},
+			},
+			expected: []expectedSet{{"Suspense-1942-06-17.mp3", "trailing-number", []string{
+				"Suspense-1942-06-17-01.mp3", "Suspense-1942-06-17-02.mp3",
+			}}},
+		},
+		{
+			name:  "browser duplicates",
+			files: []string{"Speech (1).mp3", "Speech (2).mp3"},
+		},
+		{
+			name:  "track-numbered album",
+			files: []string{"01 - Morning.mp3", "02 - Evening.mp3", "03 - Night.mp3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sets := DefaultDetector().Detect(tt.files, tt.metadata)
+			if len(sets) != len(tt.expected) {
+				t.Fatalf("Expected %d sets, got %+v", len(tt.expected), sets)
+			}
+			for i, expected := range tt.expected {
+				set := sets[i]
+				if set.OutputName != expected.output || set.Pattern != expected.pattern || !reflect.DeepEqual(set.Files, expected.files) {
+					t.Errorf("Expected %s from %s with %v, got %s from %s with %v (score %.2f: %v)",
+						expected.output, expected.pattern, expected.files, set.OutputName, set.Pattern, set.Files, set.Score, set.Evidence)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectorCustomPatterns(t *testing.T) {
+	custom, err := ParsePartPatterns([]string{`_seg(?P<part>\d+)$`})
+	if err != nil {
+		t.Fatalf("ParsePartPatterns failed: %v", err)
+	}
+	detector := &Detector{Patterns: append(custom, DefaultPartPatterns()...)}
+
+	sets := detector.Detect([]string{"show_seg2.mp3", "show_seg1.mp3"}, nil)
+	if len(sets) != 1 || sets[0].Pattern != "custom-1" || sets[0].OutputName != "show.mp3" {
+		t.Fatalf("Expected the custom pattern to group the segments, got %+v", sets)
+	}
+
+	strict := &Detector{Patterns: DefaultPartPatterns(), MinScore: 2}
+	if sets := strict.Detect([]string{"Show_Part_1.mp3", "Show_Part_2.mp3"}, nil); len(sets) != 0 {
+		t.Errorf("Expected a higher MinScore to reject the set, got %+v", sets)
+	}
+
+	for _, spec := range []string{`(unclosed`, `_seg\d+$`} {
+		if _, err := ParsePartPatterns([]string{spec}); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
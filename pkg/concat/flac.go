@@ -0,0 +1,391 @@
+package concat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	flacStreamInfo = 0
+	flacSeekTable  = 3
+
+	flacStreamInfoSize = 34
+	// flacMaxHeaderSize is the longest frame header: sync and codes, a
+	// 7-byte coded sample number, 2 bytes each of block size and sample
+	// rate, and the CRC-8.
+	flacMaxHeaderSize = 16
+	flacReadSize      = 64 << 10
+)
+
+// flacJoiner writes the frames of each part as one variable block size
+// stream, renumbering every frame by its first sample so the short last
+// frame of each part can sit mid-stream. The first part's metadata is kept,
+// except its seek table, which no longer applies.
+type flacJoiner struct {
+	out              *outputWriter
+	streamInfo       []byte
+	streamInfoOffset int64
+	samples          uint64
+	minBlock         int
+	maxBlock         int
+	lastBlock        int
+	minFrame         int
+	maxFrame         int
+}
+
+type flacFrameHeader struct {
+	blockSize int
+	// numberEnd is where the coded frame or sample number ends, and size
+	// the whole header including its CRC-8.
+	numberEnd int
+	size      int
+}
+
+func joinFLAC(out *outputWriter, files []string) error {
+	j := &flacJoiner{out: out, minBlock: math.MaxInt, minFrame: math.MaxInt}
+	for i, file := range files {
+		if err := j.addFile(file, i == 0); err != nil {
+			return err
+		}
+	}
+	if j.lastBlock == 0 {
+		return fmt.Errorf("no FLAC frames found")
+	}
+	return out.patch(j.streamInfoOffset, j.finalStreamInfo())
+}
+
+func (j *flacJoiner) addFile(path string, first bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+	r := bufio.NewReaderSize(f, flacReadSize)
+
+	blocks, err := readFLACMetadata(r)
+	if err != nil {
+		return fmt.Errorf("failed to read the metadata of %s: %w", path, err)
+	}
+	if first {
+		if err := j.writeMetadata(blocks); err != nil {
+			return err
+		}
+	}
+
+	frames := &flacFrameReader{r: r}
+	count := 0
+	for {
+		header, frame, err := frames.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err := j.writeFrame(header, frame); err != nil {
+			return err
+		}
+		count++
+	}
+	if count == 0 {
+		return fmt.Errorf("no FLAC frames found in %s", path)
+	}
+	return nil
+}
+
+// readFLACMetadata returns the metadata blocks after the fLaC marker, each
+// with its 4-byte block header.
+func readFLACMetadata(r io.Reader) ([][]byte, error) {
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil || string(marker) != "fLaC" {
+		return nil, fmt.Errorf("missing fLaC marker")
+	}
+
+	var blocks [][]byte
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		block := make([]byte, 4+length)
+		copy(block, header)
+		if _, err := io.ReadFull(r, block[4:]); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+	if len(blocks) == 0 || blocks[0][0]&0x7f != flacStreamInfo || len(blocks[0]) != 4+flacStreamInfoSize {
+		return nil, fmt.Errorf("missing STREAMINFO block")
+	}
+	return blocks, nil
+}
+
+func (j *flacJoiner) writeMetadata(blocks [][]byte) error {
+	j.streamInfo = append([]byte(nil), blocks[0][4:]...)
+
+	kept := [][]byte{blocks[0]}
+	for _, block := range blocks[1:] {
+		if block[0]&0x7f != flacSeekTable {
+			kept = append(kept, block)
+		}
+	}
+
+	if _, err := j.out.buf.WriteString("fLaC"); err != nil {
+		return err
+	}
+	for i, block := range kept {
+		block = append([]byte(nil), block...)
+		block[0] &^= 0x80
+		if i == len(kept)-1 {
+			block[0] |= 0x80
+		}
+		if i == 0 {
+			j.streamInfoOffset = j.out.offset() + 4
+		}
+		if _, err := j.out.buf.Write(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *flacJoiner) writeFrame(header flacFrameHeader, frame []byte) error {
+	var rewritten bytes.Buffer
+	rewritten.Grow(len(frame) + 4)
+	rewritten.Write(frame[:4])
+	rewritten.Bytes()[1] |= 0x01 // variable block size
+	rewritten.Write(encodeFLACNumber(j.samples))
+	rewritten.Write(frame[header.numberEnd : header.size-1])
+	rewritten.WriteByte(flacCRC8(rewritten.Bytes()))
+	rewritten.Write(frame[header.size : len(frame)-2])
+	_ = binary.Write(&rewritten, binary.BigEndian, flacCRC16(rewritten.Bytes()))
+
+	if j.lastBlock > 0 {
+		j.minBlock = min(j.minBlock, j.lastBlock)
+	}
+	j.lastBlock = header.blockSize
+	j.maxBlock = max(j.maxBlock, header.blockSize)
+	j.minFrame = min(j.minFrame, rewritten.Len())
+	j.maxFrame = max(j.maxFrame, rewritten.Len())
+	j.samples += uint64(header.blockSize)
+
+	_, err := j.out.buf.Write(rewritten.Bytes())
+	return err
+}
+
+// finalStreamInfo fills in the block and frame sizes and the sample count
+// of the joined stream. The MD5 of the audio is left unset, which decoders
+// read as unknown.
+func (j *flacJoiner) finalStreamInfo() []byte {
+	info := append([]byte(nil), j.streamInfo...)
+	minBlock := j.minBlock
+	if minBlock == math.MaxInt {
+		minBlock = j.lastBlock
+	}
+	binary.BigEndian.PutUint16(info[0:], uint16(minBlock))
+	binary.BigEndian.PutUint16(info[2:], uint16(j.maxBlock))
+	putUint24(info[4:], j.minFrame)
+	putUint24(info[7:], j.maxFrame)
+
+	packed := binary.BigEndian.Uint64(info[10:])
+	packed = packed&^(1<<36-1) | j.samples&(1<<36-1)
+	binary.BigEndian.PutUint64(info[10:], packed)
+	clear(info[18:])
+	return info
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+// flacFrameReader splits a FLAC stream into frames. A frame ends where the
+// next valid frame header starts and the bytes before it pass their CRC-16.
+type flacFrameReader struct {
+	r   io.Reader
+	buf []byte
+	eof bool
+}
+
+func (s *flacFrameReader) fill(n int) error {
+	for len(s.buf) < n && !s.eof {
+		chunk := make([]byte, flacReadSize)
+		read, err := io.ReadFull(s.r, chunk)
+		s.buf = append(s.buf, chunk[:read]...)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			s.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next returns the header and bytes of the next frame. The frame is only
+// valid until the following call.
+func (s *flacFrameReader) next() (flacFrameHeader, []byte, error) {
+	if err := s.fill(flacMaxHeaderSize); err != nil {
+		return flacFrameHeader{}, nil, err
+	}
+	if len(s.buf) == 0 {
+		return flacFrameHeader{}, nil, io.EOF
+	}
+	header, ok := parseFLACFrameHeader(s.buf)
+	if !ok {
+		return flacFrameHeader{}, nil, fmt.Errorf("invalid FLAC frame header")
+	}
+
+	crc := flacCRC16(s.buf[:header.size])
+	for end := header.size; ; end++ {
+		if err := s.fill(end + flacMaxHeaderSize); err != nil {
+			return flacFrameHeader{}, nil, err
+		}
+		if end == len(s.buf) {
+			if crc != 0 {
+				return flacFrameHeader{}, nil, fmt.Errorf("truncated FLAC frame")
+			}
+			return s.take(header, end)
+		}
+		if crc == 0 && end > header.size+2 {
+			if _, ok := parseFLACFrameHeader(s.buf[end:]); ok {
+				return s.take(header, end)
+			}
+		}
+		crc = crc<<8 ^ flacCRC16Table[byte(crc>>8)^s.buf[end]]
+	}
+}
+
+func (s *flacFrameReader) take(header flacFrameHeader, end int) (flacFrameHeader, []byte, error) {
+	frame := s.buf[:end]
+	s.buf = s.buf[end:]
+	return header, frame, nil
+}
+
+func parseFLACFrameHeader(b []byte) (flacFrameHeader, bool) {
+	if len(b) < 6 || b[0] != 0xff || b[1]&0xfe != 0xf8 {
+		return flacFrameHeader{}, false
+	}
+	blockCode, rateCode := b[2]>>4, b[2]&0x0f
+	if blockCode == 0 || rateCode == 0x0f || b[3]>>4 > 10 || b[3]&0x01 != 0 {
+		return flacFrameHeader{}, false
+	}
+
+	numberSize := 1
+	switch lead := b[4]; {
+	case lead < 0x80:
+	case lead >= 0xc0 && lead < 0xfe:
+		for lead<<numberSize&0x80 != 0 {
+			numberSize++
+		}
+	case lead == 0xfe:
+		numberSize = 7
+	default:
+		return flacFrameHeader{}, false
+	}
+
+	header := flacFrameHeader{numberEnd: 4 + numberSize}
+	size := header.numberEnd
+	if len(b) < size {
+		return flacFrameHeader{}, false
+	}
+	for _, c := range b[5:size] {
+		if c&0xc0 != 0x80 {
+			return flacFrameHeader{}, false
+		}
+	}
+
+	switch {
+	case blockCode == 1:
+		header.blockSize = 192
+	case blockCode <= 5:
+		header.blockSize = 576 << (blockCode - 2)
+	case blockCode == 6:
+		size++
+	case blockCode == 7:
+		size += 2
+	default:
+		header.blockSize = 256 << (blockCode - 8)
+	}
+	switch rateCode {
+	case 12:
+		size++
+	case 13, 14:
+		size += 2
+	}
+	if len(b) < size+1 || flacCRC8(b[:size]) != b[size] {
+		return flacFrameHeader{}, false
+	}
+	switch blockCode {
+	case 6:
+		header.blockSize = int(b[header.numberEnd]) + 1
+	case 7:
+		header.blockSize = int(binary.BigEndian.Uint16(b[header.numberEnd:])) + 1
+	}
+	header.size = size + 1
+	return header, true
+}
+
+// encodeFLACNumber codes n in the extended UTF-8 form frame headers use.
+func encodeFLACNumber(n uint64) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	size := 2
+	for n >= 1<<(5*size+1) && size < 7 {
+		size++
+	}
+	out := make([]byte, size)
+	for i := size - 1; i > 0; i-- {
+		out[i] = 0x80 | byte(n&0x3f)
+		n >>= 6
+	}
+	out[0] = byte(0xff<<(8-size)) | byte(n)
+	return out
+}
+
+var flacCRC8Table, flacCRC16Table = func() ([256]byte, [256]uint16) {
+	var crc8 [256]byte
+	var crc16 [256]uint16
+	for i := range 256 {
+		c8 := byte(i)
+		c16 := uint16(i) << 8
+		for range 8 {
+			if c8&0x80 != 0 {
+				c8 = c8<<1 ^ 0x07
+			} else {
+				c8 <<= 1
+			}
+			if c16&0x8000 != 0 {
+				c16 = c16<<1 ^ 0x8005
+			} else {
+				c16 <<= 1
+			}
+		}
+		crc8[i], crc16[i] = c8, c16
+	}
+	return crc8, crc16
+}()
+
+func flacCRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc = flacCRC8Table[crc^b]
+	}
+	return crc
+}
+
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ flacCRC16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
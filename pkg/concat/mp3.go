@@ -0,0 +1,167 @@
+package concat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// mp3Joiner copies the audio frames of each part into one stream behind a
+// fresh Xing or Info frame, keeping only the first part's ID3v2 tag.
+type mp3Joiner struct {
+	out        *outputWriter
+	first      mp3Frame
+	header     []byte
+	xingOffset int64
+	frames     int
+	bytes      int
+	bitrate    int
+	vbr        bool
+}
+
+const (
+	// xingSize is the tag, flags, frame count and byte count of a Xing
+	// header without its optional table of contents.
+	xingSize   = 16
+	xingFrames = 0x1
+	xingBytes  = 0x2
+)
+
+func joinMP3(out *outputWriter, files []string) error {
+	j := &mp3Joiner{out: out}
+	for i, file := range files {
+		if err := j.addFile(file, i == 0); err != nil {
+			return err
+		}
+	}
+	if j.frames == 0 {
+		return fmt.Errorf("no MPEG audio frames found")
+	}
+	return out.patch(j.xingOffset, j.xingFrame())
+}
+
+func (j *mp3Joiner) addFile(path string, keepTag bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+	r := bufio.NewReaderSize(f, 16<<10)
+
+	head, _ := r.Peek(10)
+	if size := id3v2Size(head); size > 0 {
+		if keepTag {
+			_, err = io.CopyN(j.out.buf, r, int64(size))
+		} else {
+			_, err = r.Discard(size)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the ID3 tag of %s: %w", path, err)
+		}
+	}
+
+	written := 0
+	synced := false
+	for {
+		head, _ := r.Peek(4)
+		if len(head) < 4 {
+			break
+		}
+		frame, ok := parseMP3Frame(head)
+		if ok && j.header != nil && (frame.sampleRate != j.first.sampleRate || frame.channels != j.first.channels) {
+			ok = false
+		}
+		data, _ := r.Peek(frame.length + 4)
+		if ok && !synced {
+			// Outside a run of frames, only trust a sync that is followed
+			// by another, so tags and junk are skipped.
+			next, nextOK := parseMP3Frame(data[min(frame.length, len(data)):])
+			ok = len(data) == frame.length || nextOK && next.sampleRate == frame.sampleRate
+		}
+		if !ok || frame.length <= 4 {
+			synced = false
+			_, _ = r.Discard(1)
+			continue
+		}
+		if len(data) < frame.length {
+			break // truncated final frame
+		}
+		synced = true
+
+		data = data[:frame.length]
+		if written == 0 && isMP3InfoFrame(frame, data) {
+			_, _ = r.Discard(frame.length)
+			continue
+		}
+		if err := j.writeFrame(frame, data); err != nil {
+			return err
+		}
+		_, _ = r.Discard(frame.length)
+		written++
+	}
+	if written == 0 {
+		return fmt.Errorf("no MPEG audio frames found in %s", path)
+	}
+	return nil
+}
+
+func (j *mp3Joiner) writeFrame(frame mp3Frame, data []byte) error {
+	if j.header == nil {
+		j.first = frame
+		j.header = append([]byte(nil), data[:4]...)
+		j.bitrate = frame.bitrate
+		j.xingOffset = j.out.offset()
+		placeholder := j.xingFrame()
+		if _, err := j.out.buf.Write(placeholder); err != nil {
+			return err
+		}
+		j.bytes += len(placeholder)
+	}
+	if frame.bitrate != j.bitrate {
+		j.vbr = true
+	}
+	j.frames++
+	j.bytes += len(data)
+	_, err := j.out.buf.Write(data)
+	return err
+}
+
+// xingFrame builds a silent frame carrying the frame and byte counts of the
+// joined stream, tagged Xing when its bitrate varies and Info otherwise.
+func (j *mp3Joiner) xingFrame() []byte {
+	header := append([]byte(nil), j.header...)
+	header[1] |= 0x01  // no CRC
+	header[2] &^= 0x02 // no padding
+	tagOffset := 4 + j.first.sideInfoSize()
+	frame, _ := parseMP3Frame(header)
+	for frame.length < tagOffset+xingSize && header[2]>>4 < 14 {
+		header[2] += 0x10
+		frame, _ = parseMP3Frame(header)
+	}
+
+	data := make([]byte, frame.length)
+	copy(data, header)
+	tag := "Info"
+	if j.vbr {
+		tag = "Xing"
+	}
+	copy(data[tagOffset:], tag)
+	binary.BigEndian.PutUint32(data[tagOffset+4:], xingFrames|xingBytes)
+	binary.BigEndian.PutUint32(data[tagOffset+8:], uint32(j.frames))
+	binary.BigEndian.PutUint32(data[tagOffset+12:], uint32(j.bytes))
+	return data
+}
+
+// isMP3InfoFrame reports whether data is a Xing, Info or VBRI frame rather
+// than audio. Those describe a single part and are dropped when joining.
+func isMP3InfoFrame(frame mp3Frame, data []byte) bool {
+	tag := 4 + frame.sideInfoSize()
+	if len(data) >= tag+4 {
+		if id := string(data[tag : tag+4]); id == "Xing" || id == "Info" {
+			return true
+		}
+	}
+	return len(data) >= 40 && string(data[36:40]) == "VBRI"
+}
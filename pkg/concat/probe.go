@@ -0,0 +1,494 @@
+package concat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	CodecMP3    = "mp3"
+	CodecFLAC   = "flac"
+	CodecPCM    = "pcm"
+	CodecVorbis = "vorbis"
+	CodecOpus   = "opus"
+	CodecAAC    = "aac"
+
+	// probeLimit bounds how much of a file is read to find its parameters.
+	probeLimit = 256 << 10
+	// mp3ScanFrames is how many MP3 frames are compared to tell constant
+	// from variable bitrate when there is no Xing, Info or VBRI header.
+	mp3ScanFrames = 32
+)
+
+var ErrUnknownFormat = errors.New("unrecognised audio format")
+
+// StreamInfo holds the stream parameters that must agree across parts for
+// them to be joined without re-encoding.
+type StreamInfo struct {
+	Codec         string `json:"codec"`
+	SampleRate    int    `json:"sample_rate"`
+	Channels      int    `json:"channels"`
+	BitsPerSample int    `json:"bits_per_sample,omitempty"`
+	// Bitrate is in kbit/s: the constant MP3 bitrate, or the nominal Ogg one.
+	Bitrate int  `json:"bitrate,omitempty"`
+	VBR     bool `json:"vbr,omitempty"`
+}
+
+func (s StreamInfo) String() string {
+	description := fmt.Sprintf("%s %d Hz %dch", s.Codec, s.SampleRate, s.Channels)
+	if s.BitsPerSample > 0 {
+		description += fmt.Sprintf(" %d-bit", s.BitsPerSample)
+	}
+	switch {
+	case s.VBR:
+		description += " VBR"
+	case s.Bitrate > 0:
+		description += fmt.Sprintf(" %d kbit/s", s.Bitrate)
+	}
+	return description
+}
+
+// ProbeFile reads the stream parameters of a WAV, FLAC, MP3 or Ogg
+// Vorbis/Opus file from its headers.
+func ProbeFile(path string) (StreamInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+
+	data, err := io.ReadAll(io.LimitReader(f, probeLimit))
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	info, err := probe(data)
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return info, nil
+}
+
+// ProbeDuration measures the running time of a WAV, FLAC or MP3 file from
+// its headers and, for constant bitrate MP3, its size.
+func ProbeDuration(path string) (time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, probeLimit))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var seconds float64
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		seconds, err = wavSeconds(data, stat.Size())
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		seconds, err = flacSeconds(data)
+	default:
+		seconds, err = mp3Seconds(data, stat.Size())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond), nil
+}
+
+func wavSeconds(data []byte, fileSize int64) (float64, error) {
+	var byteRate int
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int64(binary.LittleEndian.Uint32(data[offset+4:]))
+		switch {
+		case id == "fmt " && len(data) >= offset+8+16:
+			byteRate = int(binary.LittleEndian.Uint32(data[offset+8+8:]))
+		case id == "data" && byteRate > 0:
+			size = min(size, fileSize-int64(offset+8))
+			return float64(size) / float64(byteRate), nil
+		}
+		offset += 8 + int(size) + int(size%2)
+	}
+	return 0, fmt.Errorf("WAV file has no fmt chunk ahead of its data")
+}
+
+func flacSeconds(data []byte) (float64, error) {
+	if len(data) < 4+4+18 || data[4]&0x7f != 0 {
+		return 0, fmt.Errorf("FLAC file has no STREAMINFO block")
+	}
+	packed := binary.BigEndian.Uint64(data[8+10:])
+	rate, samples := packed>>44, packed&(1<<36-1)
+	if rate == 0 || samples == 0 {
+		return 0, fmt.Errorf("FLAC STREAMINFO does not give the sample count")
+	}
+	return float64(samples) / float64(rate), nil
+}
+
+func mp3Seconds(data []byte, fileSize int64) (float64, error) {
+	offset, first, ok := findMP3Frame(data, id3v2Size(data))
+	if !ok {
+		return 0, ErrUnknownFormat
+	}
+	samplesPerFrame := 576
+	if first.mpeg1 {
+		samplesPerFrame = 1152
+	}
+
+	frame := data[offset:min(offset+first.length, len(data))]
+	tag := 4 + first.sideInfoSize()
+	var frames uint32
+	switch {
+	case len(frame) >= tag+12 && (string(frame[tag:tag+4]) == "Xing" || string(frame[tag:tag+4]) == "Info"):
+		if binary.BigEndian.Uint32(frame[tag+4:])&xingFrames != 0 {
+			frames = binary.BigEndian.Uint32(frame[tag+8:])
+		}
+	case len(frame) >= 54 && string(frame[36:40]) == "VBRI":
+		frames = binary.BigEndian.Uint32(frame[50:])
+	}
+	if frames > 0 {
+		return float64(frames) * float64(samplesPerFrame) / float64(first.sampleRate), nil
+	}
+	return float64(fileSize-int64(offset)) * 8 / float64(first.bitrate*1000), nil
+}
+
+func probe(data []byte) (StreamInfo, error) {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return probeWAV(data)
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return probeFLAC(data)
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return probeOgg(data)
+	default:
+		return probeMP3(data)
+	}
+}
+
+func probeWAV(data []byte) (StreamInfo, error) {
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		body := data[offset+8:]
+		if id == "fmt " {
+			if size < 16 || len(body) < 16 {
+				return StreamInfo{}, fmt.Errorf("truncated WAV fmt chunk")
+			}
+			return StreamInfo{
+				Codec:         CodecPCM,
+				Channels:      int(binary.LittleEndian.Uint16(body[2:])),
+				SampleRate:    int(binary.LittleEndian.Uint32(body[4:])),
+				BitsPerSample: int(binary.LittleEndian.Uint16(body[14:])),
+			}, nil
+		}
+		offset += 8 + size + size%2
+	}
+	return StreamInfo{}, fmt.Errorf("WAV file has no fmt chunk")
+}
+
+func probeFLAC(data []byte) (StreamInfo, error) {
+	// The STREAMINFO block always comes first: a 4-byte block header, then
+	// 10 bytes of block sizes before the packed sample rate, channels and
+	// bits per sample.
+	if len(data) < 4+4+18 || data[4]&0x7f != 0 {
+		return StreamInfo{}, fmt.Errorf("FLAC file has no STREAMINFO block")
+	}
+	packed := binary.BigEndian.Uint64(data[8+10:])
+	return StreamInfo{
+		Codec:         CodecFLAC,
+		SampleRate:    int(packed >> 44),
+		Channels:      int(packed>>41&0x7) + 1,
+		BitsPerSample: int(packed>>36&0x1f) + 1,
+	}, nil
+}
+
+func probeOgg(data []byte) (StreamInfo, error) {
+	// The first page carries the codec identification header on its own.
+	if len(data) < 27 {
+		return StreamInfo{}, fmt.Errorf("truncated Ogg page")
+	}
+	segments := int(data[26])
+	if len(data) < 27+segments {
+		return StreamInfo{}, fmt.Errorf("truncated Ogg page")
+	}
+	packet := data[27+segments:]
+
+	switch {
+	case len(packet) >= 28 && bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return StreamInfo{
+			Codec:      CodecVorbis,
+			Channels:   int(packet[11]),
+			SampleRate: int(binary.LittleEndian.Uint32(packet[12:])),
+			Bitrate:    int(int32(binary.LittleEndian.Uint32(packet[20:]))) / 1000,
+		}, nil
+	case len(packet) >= 19 && bytes.HasPrefix(packet, []byte("OpusHead")):
+		// Opus always decodes at 48 kHz, whatever the input rate was.
+		return StreamInfo{Codec: CodecOpus, Channels: int(packet[9]), SampleRate: 48000}, nil
+	}
+	return StreamInfo{}, fmt.Errorf("Ogg stream is neither Vorbis nor Opus")
+}
+
+type mp3Frame struct {
+	mpeg1      bool
+	bitrate    int
+	sampleRate int
+	channels   int
+	length     int
+}
+
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	}
+	mp3SampleRates = map[byte][3]int{
+		3: {44100, 48000, 32000}, // MPEG 1
+		2: {22050, 24000, 16000}, // MPEG 2
+		0: {11025, 12000, 8000},  // MPEG 2.5
+	}
+)
+
+// parseMP3Frame reads the MPEG audio layer III frame header at the start of
+// b.
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return mp3Frame{}, false
+	}
+	version := b[1] >> 3 & 0x3
+	layer := b[1] >> 1 & 0x3
+	rates, ok := mp3SampleRates[version]
+	bitrateIndex := b[2] >> 4
+	rateIndex := b[2] >> 2 & 0x3
+	if !ok || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+
+	frame := mp3Frame{mpeg1: version == 3, sampleRate: rates[rateIndex], channels: 2}
+	if frame.mpeg1 {
+		frame.bitrate = mp3Bitrates[1][bitrateIndex]
+		frame.length = 144 * frame.bitrate * 1000 / frame.sampleRate
+	} else {
+		frame.bitrate = mp3Bitrates[0][bitrateIndex]
+		frame.length = 72 * frame.bitrate * 1000 / frame.sampleRate
+	}
+	frame.length += int(b[2] >> 1 & 0x1)
+	if b[3]>>6 == 3 {
+		frame.channels = 1
+	}
+	return frame, true
+}
+
+// sideInfoSize is the size of the side information that follows the frame
+// header, which is where a Xing or Info header sits.
+func (f mp3Frame) sideInfoSize() int {
+	switch {
+	case f.mpeg1 && f.channels == 1:
+		return 17
+	case f.mpeg1:
+		return 32
+	case f.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// id3v2Size returns the length of an ID3v2 tag at the start of data.
+func id3v2Size(data []byte) int {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return 0
+	}
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+	if data[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return 10 + size
+}
+
+// findMP3Frame returns the offset of the first frame at or after start that
+// is followed by another valid frame, to skip false syncs in tag data.
+func findMP3Frame(data []byte, start int) (int, mp3Frame, bool) {
+	for offset := start; offset+4 <= len(data); offset++ {
+		frame, ok := parseMP3Frame(data[offset:])
+		if !ok || frame.length <= 4 {
+			continue
+		}
+		next := offset + frame.length
+		if next+4 > len(data) {
+			return offset, frame, true
+		}
+		if _, ok := parseMP3Frame(data[next:]); ok {
+			return offset, frame, true
+		}
+	}
+	return 0, mp3Frame{}, false
+}
+
+func probeMP3(data []byte) (StreamInfo, error) {
+	offset, first, ok := findMP3Frame(data, id3v2Size(data))
+	if !ok {
+		return StreamInfo{}, ErrUnknownFormat
+	}
+	info := StreamInfo{Codec: CodecMP3, SampleRate: first.sampleRate, Channels: first.channels, Bitrate: first.bitrate}
+
+	frame := data[offset:min(offset+first.length, len(data))]
+	tag := 4 + first.sideInfoSize()
+	switch {
+	case len(frame) >= tag+4 && string(frame[tag:tag+4]) == "Xing":
+		info.VBR, info.Bitrate = true, 0
+		return info, nil
+	case len(frame) >= tag+4 && string(frame[tag:tag+4]) == "Info":
+		// An Info header marks a constant bitrate file; its own frame may
+		// be encoded at a different rate from the audio.
+		if next, ok := parseMP3Frame(data[min(offset+first.length, len(data)):]); ok {
+			info.Bitrate = next.bitrate
+		}
+		return info, nil
+	case len(frame) >= 40 && string(frame[36:40]) == "VBRI":
+		info.VBR, info.Bitrate = true, 0
+		return info, nil
+	}
+
+	for i := 0; i < mp3ScanFrames && offset+4 <= len(data); i++ {
+		frame, ok := parseMP3Frame(data[offset:])
+		if !ok {
+			break
+		}
+		if frame.bitrate != info.Bitrate {
+			info.VBR, info.Bitrate = true, 0
+			break
+		}
+		offset += frame.length
+	}
+	return info, nil
+}
+
+const (
+	PathCopy     = "copy"
+	PathReencode = "reencode"
+)
+
+// Plan is how a set of parts gets joined: by stream copy when their
+// parameters agree, otherwise by re-encoding to Target, the highest of each
+// parameter across the parts. Backend names the Concatenator that ran it.
+type Plan struct {
+	Path    string       `json:"path"`
+	Backend string       `json:"backend,omitempty"`
+	Reason  string       `json:"reason"`
+	Target  StreamInfo   `json:"target"`
+	Inputs  []StreamInfo `json:"inputs,omitempty"`
+}
+
+// PlanConcat probes files and plans their concatenation into a file with
+// the extension ext. Parts that cannot be probed are stream copied, as
+// before probing existed, except WAV, which is re-encoded to 16-bit PCM.
+func PlanConcat(files []string, ext string) Plan {
+	inputs := make([]StreamInfo, 0, len(files))
+	for _, file := range files {
+		info, err := ProbeFile(file)
+		if err != nil {
+			plan := Plan{Path: PathCopy, Reason: fmt.Sprintf("could not read stream parameters (%v)", err)}
+			if isWAV(ext) {
+				plan.Path, plan.Target = PathReencode, StreamInfo{Codec: CodecPCM, BitsPerSample: 16}
+			}
+			return plan
+		}
+		inputs = append(inputs, info)
+	}
+	return planFor(inputs, ext)
+}
+
+func planFor(inputs []StreamInfo, ext string) Plan {
+	plan := Plan{Path: PathCopy, Inputs: inputs}
+	if len(inputs) == 0 {
+		plan.Reason = "no parts to compare"
+		return plan
+	}
+
+	first := inputs[0]
+	target := first
+	for _, info := range inputs[1:] {
+		target.SampleRate = max(target.SampleRate, info.SampleRate)
+		target.Channels = max(target.Channels, info.Channels)
+		target.BitsPerSample = max(target.BitsPerSample, info.BitsPerSample)
+		target.Bitrate = max(target.Bitrate, info.Bitrate)
+		target.VBR = target.VBR || info.VBR
+	}
+	if target.VBR {
+		target.Bitrate = 0
+	}
+	differences := mismatches(inputs, false)
+	if codec := codecForExt(ext); codec != "" && codec != target.Codec && target.Codec != CodecOpus {
+		differences = append(differences, fmt.Sprintf("%s output needs %s, not %s", strings.TrimPrefix(ext, "."), codec, target.Codec))
+		target.Codec = codec
+	}
+	if len(differences) == 0 {
+		plan.Target = first
+		plan.Reason = "all parts are " + first.String()
+		return plan
+	}
+	plan.Path = PathReencode
+	plan.Target = target
+	plan.Reason = strings.Join(differences, "; ")
+	return plan
+}
+
+// mismatches describes how each part differs from the first. Mixing
+// constant and variable bitrate counts unless ignoreBitrateMode is set.
+func mismatches(inputs []StreamInfo, ignoreBitrateMode bool) []string {
+	var differences []string
+	first := inputs[0]
+	for i, info := range inputs[1:] {
+		if info.Codec != first.Codec {
+			differences = append(differences, fmt.Sprintf("part %d is %s, not %s", i+2, info.Codec, first.Codec))
+		}
+		if info.SampleRate != first.SampleRate {
+			differences = append(differences, fmt.Sprintf("part %d is sampled at %d Hz, not %d Hz", i+2, info.SampleRate, first.SampleRate))
+		}
+		if info.Channels != first.Channels {
+			differences = append(differences, fmt.Sprintf("part %d has %d channels, not %d", i+2, info.Channels, first.Channels))
+		}
+		if info.BitsPerSample != first.BitsPerSample {
+			differences = append(differences, fmt.Sprintf("part %d has %d-bit samples, not %d-bit", i+2, info.BitsPerSample, first.BitsPerSample))
+		}
+		if info.VBR != first.VBR && !ignoreBitrateMode {
+			differences = append(differences, fmt.Sprintf("part %d mixes constant and variable bitrate", i+2))
+		}
+	}
+	return differences
+}
+
+func codecForExt(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".mp3":
+		return CodecMP3
+	case ".flac":
+		return CodecFLAC
+	case ".wav", ".wave":
+		return CodecPCM
+	case ".ogg":
+		return CodecVorbis
+	case ".opus":
+		return CodecOpus
+	case ".m4a", ".m4b":
+		return CodecAAC
+	}
+	return ""
+}
+
+func isWAV(ext string) bool {
+	ext = strings.ToLower(ext)
+	return ext == ".wav" || ext == ".wave"
+}
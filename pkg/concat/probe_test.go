@@ -0,0 +1,188 @@
+package concat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func wavFile(sampleRate, channels, bits int, samples []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	_ = binary.Write(&b, binary.LittleEndian, uint32(36+len(samples)))
+	b.WriteString("WAVEfmt ")
+	blockAlign := channels * bits / 8
+	for _, v := range []any{
+		uint32(16), uint16(1), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * blockAlign), uint16(blockAlign), uint16(bits),
+	} {
+		_ = binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	_ = binary.Write(&b, binary.LittleEndian, uint32(len(samples)))
+	b.Write(samples)
+	return b.Bytes()
+}
+
+func flacFile(sampleRate, channels, bits int, totalSamples uint64, frames []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	b.Write([]byte{0x80, 0, 0, 34})
+	_ = binary.Write(&b, binary.BigEndian, []uint16{4096, 4096})
+	b.Write(make([]byte, 6))
+	packed := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(bits-1)<<36 | totalSamples
+	_ = binary.Write(&b, binary.BigEndian, packed)
+	b.Write(make([]byte, 16))
+	b.Write(frames)
+	return b.Bytes()
+}
+
+// mp3Frames builds MPEG-1 layer III frames at 44.1 kHz with the given
+// bitrate indexes, marking the first as a Xing frame when xing is set.
+func mp3Frames(mono, xing bool, bitrateIndexes ...byte) []byte {
+	var b bytes.Buffer
+	for i, index := range bitrateIndexes {
+		header := []byte{0xff, 0xfb, index << 4, 0x00}
+		if mono {
+			header[3] = 0xc0
+		}
+		frame, _ := parseMP3Frame(header)
+		body := make([]byte, frame.length)
+		copy(body, header)
+		if i == 0 && xing {
+			copy(body[4+frame.sideInfoSize():], "Xing")
+		}
+		b.Write(body)
+	}
+	return b.Bytes()
+}
+
+func oggVorbisFile(sampleRate, channels, nominalBitrate int) []byte {
+	var packet bytes.Buffer
+	packet.WriteString("\x01vorbis")
+	for _, v := range []any{
+		uint32(0), uint8(channels), uint32(sampleRate), int32(0), int32(nominalBitrate), int32(0), uint8(0xb8), uint8(1),
+	} {
+		_ = binary.Write(&packet, binary.LittleEndian, v)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("OggS")
+	b.Write([]byte{0, 2})
+	b.Write(make([]byte, 8+4+4+4))
+	b.Write([]byte{1, byte(packet.Len())})
+	b.Write(packet.Bytes())
+	return b.Bytes()
+}
+
+func TestProbe(t *testing.T) {
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x0a"), make([]byte, 10)...)
+	opus := append([]byte("OggS\x00\x02"), make([]byte, 20)...)
+	opus = append(opus, 1, 19)
+	opus = append(opus, []byte("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00")...)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected StreamInfo
+	}{
+		{"wav", wavFile(48000, 2, 24, make([]byte, 12)), StreamInfo{Codec: CodecPCM, SampleRate: 48000, Channels: 2, BitsPerSample: 24}},
+		{"flac", flacFile(44100, 2, 16, 1000, nil), StreamInfo{Codec: CodecFLAC, SampleRate: 44100, Channels: 2, BitsPerSample: 16}},
+		{"cbr mp3", mp3Frames(false, false, 9, 9, 9), StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, Bitrate: 128}},
+		{"mp3 after id3 tag", append(id3, mp3Frames(true, false, 11, 11)...), StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 1, Bitrate: 192}},
+		{"vbr mp3 without header", mp3Frames(false, false, 9, 11, 5), StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, VBR: true}},
+		{"vbr mp3 with xing header", mp3Frames(false, true, 9, 9, 9), StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, VBR: true}},
+		{"ogg vorbis", oggVorbisFile(44100, 2, 160000), StreamInfo{Codec: CodecVorbis, SampleRate: 44100, Channels: 2, Bitrate: 160}},
+		{"ogg opus", opus, StreamInfo{Codec: CodecOpus, SampleRate: 48000, Channels: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probe(tt.data)
+			if err != nil {
+				t.Fatalf("probe failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := probe([]byte("not audio at all")); err == nil {
+		t.Error("Expected an error for unrecognised data")
+	}
+}
+
+func TestPlanConcat(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	cbr128 := write("cbr128.mp3", mp3Frames(false, false, 9, 9))
+	cbr128b := write("cbr128b.mp3", mp3Frames(false, false, 9, 9, 9))
+	cbr192 := write("cbr192.mp3", mp3Frames(false, false, 11, 11))
+	vbr := write("vbr.mp3", mp3Frames(false, true, 9, 9))
+	mono := write("mono.mp3", mp3Frames(true, false, 9, 9))
+	cd := write("cd.wav", wavFile(44100, 2, 16, make([]byte, 8)))
+	hires := write("hires.wav", wavFile(96000, 2, 24, make([]byte, 12)))
+	garbage := write("garbage.wav", []byte("garbage"))
+
+	tests := []struct {
+		name     string
+		files    []string
+		ext      string
+		path     string
+		expected StreamInfo
+	}{
+		{"matching mp3", []string{cbr128, cbr128b}, ".mp3", PathCopy, StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, Bitrate: 128}},
+		{"cbr bitrates differ", []string{cbr128, cbr192}, ".mp3", PathCopy, StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, Bitrate: 128}},
+		{"cbr and vbr", []string{cbr192, vbr}, ".mp3", PathReencode, StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, VBR: true}},
+		{"mono and stereo", []string{mono, cbr192}, ".mp3", PathReencode, StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, Bitrate: 192}},
+		{"sample rates differ", []string{cd, hires}, ".wav", PathReencode, StreamInfo{Codec: CodecPCM, SampleRate: 96000, Channels: 2, BitsPerSample: 24}},
+		{"unreadable wav", []string{cd, garbage}, ".wav", PathReencode, StreamInfo{Codec: CodecPCM, BitsPerSample: 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := PlanConcat(tt.files, tt.ext)
+			if plan.Path != tt.path || plan.Target != tt.expected || plan.Reason == "" {
+				t.Errorf("Expected %s to %+v, got %+v", tt.path, tt.expected, plan)
+			}
+		})
+	}
+}
+
+func TestReencodeArgs(t *testing.T) {
+	args := reencodeArgs([]string{"/a.mp3", "/b.mp3"}, StreamInfo{Codec: CodecMP3, SampleRate: 44100, Channels: 2, Bitrate: 192})
+	expected := []string{
+		"-i", "/a.mp3", "-i", "/b.mp3",
+		"-filter_complex", "[0:a]aformat=sample_rates=44100:channel_layouts=stereo[a0];[1:a]aformat=sample_rates=44100:channel_layouts=stereo[a1];[a0][a1]concat=n=2:v=0:a=1[out]",
+		"-map", "[out]", "-c:a", "libmp3lame", "-b:a", "192k",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %q, got %q", expected, args)
+	}
+
+	tests := []struct {
+		target   StreamInfo
+		expected []string
+	}{
+		{StreamInfo{Codec: CodecMP3, VBR: true}, []string{"-c:a", "libmp3lame", "-q:a", "0"}},
+		{StreamInfo{Codec: CodecFLAC, BitsPerSample: 24}, []string{"-c:a", "flac", "-sample_fmt", "s32", "-bits_per_raw_sample", "24"}},
+		{StreamInfo{Codec: CodecPCM, BitsPerSample: 24}, []string{"-c:a", "pcm_s24le"}},
+		{StreamInfo{Codec: CodecVorbis}, []string{"-c:a", "libvorbis", "-q:a", "6"}},
+	}
+	for _, tt := range tests {
+		if got := encoderArgs(tt.target); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Expected %q for %+v, got %q", tt.expected, tt.target, got)
+		}
+	}
+}
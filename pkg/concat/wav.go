@@ -0,0 +1,122 @@
+package concat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// wavPart is where the audio of one WAV part sits.
+type wavPart struct {
+	path       string
+	format     []byte
+	dataOffset int64
+	dataSize   int64
+}
+
+// joinWAV writes one RIFF file holding the fmt chunk of the first part and
+// the samples of every part. Other chunks, such as LIST tags, are dropped.
+func joinWAV(out *outputWriter, files []string) error {
+	parts := make([]wavPart, 0, len(files))
+	var total int64
+	for i, file := range files {
+		part, err := readWAVPart(file)
+		if err != nil {
+			return err
+		}
+		if i > 0 && !bytes.Equal(part.format, parts[0].format) {
+			return fmt.Errorf("%w: part %d has a different WAV format from part 1", ErrNotJoinable, i+1)
+		}
+		parts = append(parts, part)
+		total += part.dataSize
+	}
+
+	format := parts[0].format
+	headerSize := int64(4 + 8 + len(format) + len(format)%2 + 8)
+	if total+total%2+headerSize > math.MaxUint32 {
+		return fmt.Errorf("%w: the joined samples exceed the 4 GiB WAV limit", ErrNotJoinable)
+	}
+
+	var header bytes.Buffer
+	header.WriteString("RIFF")
+	_ = binary.Write(&header, binary.LittleEndian, uint32(headerSize+total+total%2))
+	header.WriteString("WAVEfmt ")
+	_ = binary.Write(&header, binary.LittleEndian, uint32(len(format)))
+	header.Write(format)
+	if len(format)%2 == 1 {
+		header.WriteByte(0)
+	}
+	header.WriteString("data")
+	_ = binary.Write(&header, binary.LittleEndian, uint32(total))
+	if _, err := out.buf.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if err := copyWAVData(out, part); err != nil {
+			return err
+		}
+	}
+	if total%2 == 1 {
+		return out.buf.WriteByte(0)
+	}
+	return nil
+}
+
+func readWAVPart(path string) (wavPart, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return wavPart{}, err
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+
+	stat, err := f.Stat()
+	if err != nil {
+		return wavPart{}, err
+	}
+
+	part := wavPart{path: path}
+	header := make([]byte, 8)
+	for offset := int64(12); offset+8 <= stat.Size(); {
+		if _, err := f.ReadAt(header, offset); err != nil {
+			return wavPart{}, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		switch string(header[:4]) {
+		case "fmt ":
+			part.format = make([]byte, size)
+			if _, err := f.ReadAt(part.format, offset+8); err != nil {
+				return wavPart{}, fmt.Errorf("failed to read the fmt chunk of %s: %w", path, err)
+			}
+		case "data":
+			// Streamed WAV files may leave the size unset, so trust the file
+			// length over it.
+			part.dataOffset = offset + 8
+			part.dataSize = min(size, stat.Size()-part.dataOffset)
+			if size == 0 || size == math.MaxUint32 {
+				part.dataSize = stat.Size() - part.dataOffset
+			}
+		}
+		if part.format != nil && part.dataOffset > 0 {
+			return part, nil
+		}
+		offset += 8 + size + size%2
+	}
+	return wavPart{}, fmt.Errorf("%s has no fmt or data chunk", path)
+}
+
+func copyWAVData(out *outputWriter, part wavPart) error {
+	f, err := os.Open(part.path)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) { _ = f.Close() }(f)
+
+	if _, err := io.Copy(out.buf, io.NewSectionReader(f, part.dataOffset, part.dataSize)); err != nil {
+		return fmt.Errorf("failed to copy samples from %s: %w", part.path, err)
+	}
+	return nil
+}
@@ -2,21 +2,43 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/concat"
 )
 
 type Config struct {
 	AudioFormatPreference []archive.AudioFormat
-	MaxResults            int    `env:"IA_MAX_RESULTS" envDefault:"10"`
-	DownloadDirectory     string `env:"IA_DOWNLOAD_DIR"`
-	AccessKey             string `env:"IA_S3_ACCESS_KEY"`
-	SecretKey             string `env:"IA_S3_SECRET_KEY"`
-	FFMPEG                string `env:"IA_FFMPEG" envDefault:"ffmpeg"`
-	ConcatAskThreshold    int    `env:"IA_CONCAT_ASK_THRESH" envDefault:"5"`
+	MaxResults            int           `env:"IA_MAX_RESULTS" envDefault:"10"`
+	DownloadDirectory     string        `env:"IA_DOWNLOAD_DIR"`
+	AccessKey             string        `env:"IA_S3_ACCESS_KEY"`
+	SecretKey             string        `env:"IA_S3_SECRET_KEY"`
+	FFMPEG                string        `env:"IA_FFMPEG" envDefault:"ffmpeg"`
+	ConcatAskThreshold    int           `env:"IA_CONCAT_ASK_THRESH" envDefault:"5"`
+	ConcatBackend         string        `env:"IA_CONCAT_BACKEND" envDefault:"auto"`
+	SearchURL             string        `env:"IA_SEARCH_URL"`
+	ScrapeURL             string        `env:"IA_SCRAPE_URL"`
+	MetadataURL           string        `env:"IA_METADATA_URL"`
+	DownloadURL           string        `env:"IA_DOWNLOAD_URL"`
+	S3URL                 string        `env:"IA_S3_URL"`
+	DownloadConcurrency   int           `env:"IA_DOWNLOAD_CONCURRENCY" envDefault:"4"`
+	JobConcurrency        int           `env:"IA_JOB_CONCURRENCY" envDefault:"1"`
+	Licenses              []string      `env:"IA_LICENSES" envSeparator:"," envDefault:"by,by-sa,by-nd,by-nc,by-nc-sa,by-nc-nd,cc0,pdm"`
+	MaxRetries            int           `env:"IA_MAX_RETRIES" envDefault:"4"`
+	RetryBaseDelay        time.Duration `env:"IA_RETRY_BASE_DELAY" envDefault:"1s"`
+	RetryMaxDelay         time.Duration `env:"IA_RETRY_MAX_DELAY" envDefault:"30s"`
+	RateLimit             float64       `env:"IA_RATE_LIMIT" envDefault:"5"`
+	RateBurst             int           `env:"IA_RATE_BURST" envDefault:"10"`
+	EnableUpload          bool          `env:"IA_ENABLE_UPLOAD" envDefault:"false"`
+	UploadDirectory       string        `env:"IA_UPLOAD_DIR"`
+	UploadPartSize        int64         `env:"IA_UPLOAD_PART_SIZE" envDefault:"67108864"`
+	PartPatterns          []string      `env:"IA_PART_PATTERNS" envSeparator:";"`
+	PartMinScore          float64       `env:"IA_PART_MIN_SCORE" envDefault:"1"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -38,6 +60,9 @@ func LoadConfig() (*Config, error) {
 		}
 		cfg.DownloadDirectory = filepath.Join(homeDir, "Downloads")
 	}
+	if cfg.UploadDirectory == "" {
+		cfg.UploadDirectory = cfg.DownloadDirectory
+	}
 
 	return cfg, nil
 }
@@ -49,12 +74,107 @@ func (c *Config) APIKey() string {
 	return c.AccessKey + ":" + c.SecretKey
 }
 
+func (c *Config) LicensePolicy() (archive.LicensePolicy, error) {
+	if len(c.Licenses) == 0 {
+		return archive.DefaultLicensePolicy(), nil
+	}
+	return archive.ParseLicensePolicy(c.Licenses)
+}
+
+// PartDetector returns a multi-part detector that tries PartPatterns before
+// the built-in patterns.
+func (c *Config) PartDetector() (*concat.Detector, error) {
+	custom, err := concat.ParsePartPatterns(c.PartPatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &concat.Detector{
+		Patterns: append(custom, concat.DefaultPartPatterns()...),
+		MinScore: c.PartMinScore,
+	}, nil
+}
+
+// Concatenator returns the backend that joins multi-part sets, checking for
+// ffmpeg when ConcatBackend needs it.
+func (c *Config) Concatenator() (concat.Concatenator, error) {
+	return concat.NewConcatenator(c.ConcatBackend, c.FFMPEG)
+}
+
+func (c *Config) ClientOptions() ([]archive.Option, error) {
+	policy, err := c.LicensePolicy()
+	if err != nil {
+		return nil, err
+	}
+	return []archive.Option{
+		archive.WithLicensePolicy(policy),
+		archive.WithSearchURL(c.SearchURL),
+		archive.WithScrapeURL(c.ScrapeURL),
+		archive.WithMetadataURL(c.MetadataURL),
+		archive.WithDownloadURL(c.DownloadURL),
+		archive.WithS3URL(c.S3URL),
+		archive.WithRetryPolicy(archive.RetryPolicy{
+			MaxRetries: c.MaxRetries,
+			BaseDelay:  c.RetryBaseDelay,
+			MaxDelay:   c.RetryMaxDelay,
+		}),
+		archive.WithRateLimit(c.RateLimit, c.RateBurst),
+		archive.WithUploadPartSize(c.UploadPartSize),
+	}, nil
+}
+
 func (c *Config) Validate() error {
 	if c.MaxResults <= 0 {
 		return fmt.Errorf("MaxResults must be greater than 0")
 	}
+	if c.DownloadConcurrency < 0 {
+		return fmt.Errorf("DownloadConcurrency cannot be negative")
+	}
+	if c.JobConcurrency < 0 {
+		return fmt.Errorf("JobConcurrency cannot be negative")
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("MaxRetries cannot be negative")
+	}
+	if c.RetryBaseDelay < 0 || c.RetryMaxDelay < 0 {
+		return fmt.Errorf("retry delays cannot be negative")
+	}
+	if c.RateLimit < 0 || c.RateBurst < 0 {
+		return fmt.Errorf("RateLimit and RateBurst cannot be negative")
+	}
+	if c.UploadPartSize != 0 && c.UploadPartSize < archive.MinUploadPartSize {
+		return fmt.Errorf("UploadPartSize must be at least %d bytes", archive.MinUploadPartSize)
+	}
+	if c.EnableUpload && c.APIKey() == "" {
+		return fmt.Errorf("IA_ENABLE_UPLOAD requires IA_S3_ACCESS_KEY and IA_S3_SECRET_KEY")
+	}
+	if _, err := c.LicensePolicy(); err != nil {
+		return fmt.Errorf("invalid Licenses: %w", err)
+	}
+	if c.PartMinScore <= 0 {
+		return fmt.Errorf("PartMinScore must be greater than 0")
+	}
+	if _, err := c.PartDetector(); err != nil {
+		return fmt.Errorf("invalid PartPatterns: %w", err)
+	}
+	if !concat.ValidBackend(c.ConcatBackend) {
+		return fmt.Errorf("ConcatBackend must be %s, %s or %s, got %q", concat.BackendAuto, concat.BackendFFMPEG, concat.BackendNative, c.ConcatBackend)
+	}
 	if len(c.AudioFormatPreference) == 0 {
 		return fmt.Errorf("AudioFormatPreference cannot be empty")
 	}
+	for _, endpoint := range []struct{ name, value string }{
+		{"SearchURL", c.SearchURL},
+		{"ScrapeURL", c.ScrapeURL},
+		{"MetadataURL", c.MetadataURL},
+		{"DownloadURL", c.DownloadURL},
+		{"S3URL", c.S3URL},
+	} {
+		if endpoint.value == "" {
+			continue
+		}
+		if u, err := url.Parse(endpoint.value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s must be an absolute URL, got %q", endpoint.name, endpoint.value)
+		}
+	}
 	return nil
 }
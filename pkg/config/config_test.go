@@ -2,9 +2,12 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/palanquin-software/mcp-internet-archive/pkg/archive"
+	"github.com/palanquin-software/mcp-internet-archive/pkg/concat"
 )
 
 func TestLoadConfigDefaults(t *testing.T) {
@@ -35,6 +38,52 @@ func TestLoadConfigDefaults(t *testing.T) {
 	if cfg.DownloadDirectory == "" {
 		t.Error("Expected non-empty DownloadDirectory")
 	}
+
+	if cfg.DownloadConcurrency != 4 {
+		t.Errorf("Expected default DownloadConcurrency 4, got %d", cfg.DownloadConcurrency)
+	}
+
+	if cfg.PartMinScore != 1 || len(cfg.PartPatterns) != 0 {
+		t.Errorf("Expected default part detection, got %v %v", cfg.PartMinScore, cfg.PartPatterns)
+	}
+
+	if cfg.ConcatBackend != "auto" {
+		t.Errorf("Expected the auto concatenation backend, got %q", cfg.ConcatBackend)
+	}
+
+	if cfg.EnableUpload || cfg.UploadDirectory != cfg.DownloadDirectory {
+		t.Errorf("Expected uploads disabled and reading from the download directory, got %v %q", cfg.EnableUpload, cfg.UploadDirectory)
+	}
+
+	policy, err := cfg.LicensePolicy()
+	if err != nil {
+		t.Fatalf("LicensePolicy failed: %v", err)
+	}
+	if !policy.Allows(archive.CCBYNC) || !policy.Allows(archive.PublicDomainMark) || policy.Allows(archive.UnknownLicense) {
+		t.Errorf("Unexpected default license policy: %v", policy.Allowed)
+	}
+}
+
+func TestLoadConfigLicensesFromEnv(t *testing.T) {
+	_ = os.Setenv("IA_LICENSES", "by, by-sa,cc0,pdm,unknown")
+	_ = os.Setenv("IA_DOWNLOAD_DIR", "/tmp/test-archive")
+	defer os.Clearenv()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	policy, err := cfg.LicensePolicy()
+	if err != nil {
+		t.Fatalf("LicensePolicy failed: %v", err)
+	}
+	if len(policy.Allowed) != 5 {
+		t.Errorf("Expected 5 allowed licenses, got %v", policy.Allowed)
+	}
+	if policy.Allows(archive.CCBYNC) || !policy.Allows(archive.UnknownLicense) {
+		t.Errorf("Unexpected license policy: %v", policy.Allowed)
+	}
 }
 
 func TestLoadConfigFromEnv(t *testing.T) {
@@ -62,6 +111,99 @@ func TestLoadConfigFromEnv(t *testing.T) {
 	}
 }
 
+func TestLoadConfigEndpointsFromEnv(t *testing.T) {
+	_ = os.Setenv("IA_SEARCH_URL", "http://127.0.0.1:8080/advancedsearch.php")
+	_ = os.Setenv("IA_METADATA_URL", "http://127.0.0.1:8080/metadata")
+	_ = os.Setenv("IA_DOWNLOAD_URL", "http://127.0.0.1:8080/download")
+	_ = os.Setenv("IA_DOWNLOAD_DIR", "/tmp/test-archive")
+	defer os.Clearenv()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if cfg.SearchURL != "http://127.0.0.1:8080/advancedsearch.php" {
+		t.Errorf("Expected SearchURL from env, got '%s'", cfg.SearchURL)
+	}
+
+	if cfg.MetadataURL != "http://127.0.0.1:8080/metadata" {
+		t.Errorf("Expected MetadataURL from env, got '%s'", cfg.MetadataURL)
+	}
+
+	if cfg.DownloadURL != "http://127.0.0.1:8080/download" {
+		t.Errorf("Expected DownloadURL from env, got '%s'", cfg.DownloadURL)
+	}
+
+	options, err := cfg.ClientOptions()
+	if err != nil {
+		t.Fatalf("ClientOptions failed: %v", err)
+	}
+	if len(options) != 9 {
+		t.Errorf("Expected 9 client options, got %d", len(options))
+	}
+}
+
+func TestConfigClientOptionsInvalidLicenses(t *testing.T) {
+	cfg := Config{Licenses: []string{"by", "gpl"}}
+	if _, err := cfg.ClientOptions(); err == nil {
+		t.Error("Expected error for unknown license")
+	}
+}
+
+func TestLoadConfigRetryFromEnv(t *testing.T) {
+	_ = os.Setenv("IA_MAX_RETRIES", "2")
+	_ = os.Setenv("IA_RETRY_BASE_DELAY", "250ms")
+	_ = os.Setenv("IA_RATE_LIMIT", "0.5")
+	_ = os.Setenv("IA_DOWNLOAD_DIR", "/tmp/test-archive")
+	defer os.Clearenv()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if cfg.MaxRetries != 2 {
+		t.Errorf("Expected MaxRetries 2, got %d", cfg.MaxRetries)
+	}
+
+	if cfg.RetryBaseDelay != 250*time.Millisecond {
+		t.Errorf("Expected RetryBaseDelay 250ms, got %v", cfg.RetryBaseDelay)
+	}
+
+	if cfg.RetryMaxDelay != 30*time.Second {
+		t.Errorf("Expected default RetryMaxDelay 30s, got %v", cfg.RetryMaxDelay)
+	}
+
+	if cfg.RateLimit != 0.5 {
+		t.Errorf("Expected RateLimit 0.5, got %v", cfg.RateLimit)
+	}
+}
+
+func TestLoadConfigPartPatternsFromEnv(t *testing.T) {
+	_ = os.Setenv("IA_PART_PATTERNS", `_seg(?P<part>\d+)$;-reel(?P<part>\d{1,2})`)
+	_ = os.Setenv("IA_PART_MIN_SCORE", "1.5")
+	_ = os.Setenv("IA_DOWNLOAD_DIR", "/tmp/test-archive")
+	defer os.Clearenv()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if len(cfg.PartPatterns) != 2 || cfg.PartMinScore != 1.5 {
+		t.Fatalf("Unexpected part settings: %v, %v", cfg.PartPatterns, cfg.PartMinScore)
+	}
+
+	detector, err := cfg.PartDetector()
+	if err != nil {
+		t.Fatalf("PartDetector failed: %v", err)
+	}
+	if len(detector.Patterns) != len(concat.DefaultPartPatterns())+2 || detector.Patterns[1].Name != "custom-2" {
+		t.Errorf("Expected the custom patterns ahead of the defaults, got %d patterns", len(detector.Patterns))
+	}
+}
+
 func TestConfigValidate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -73,6 +215,7 @@ func TestConfigValidate(t *testing.T) {
 			cfg: Config{
 				MaxResults:            10,
 				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				PartMinScore:          1,
 			},
 			wantErr: false,
 		},
@@ -100,6 +243,126 @@ func TestConfigValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "negative download concurrency",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				DownloadConcurrency:   -2,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown license",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				Licenses:              []string{"by", "gpl"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative retries",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				MaxRetries:            -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative rate limit",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				RateLimit:             -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "upload without credentials",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				EnableUpload:          true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "tiny upload parts",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				UploadPartSize:        1024,
+			},
+			wantErr: true,
+		},
+		{
+			name: "mirror endpoints",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				PartMinScore:          1,
+				MetadataURL:           "http://mirror.local/metadata",
+				DownloadURL:           "http://mirror.local/download",
+			},
+			wantErr: false,
+		},
+		{
+			name: "zero part min score",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+			},
+			wantErr: true,
+		},
+		{
+			name: "custom part pattern",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				PartMinScore:          1,
+				PartPatterns:          []string{`_seg(?P<part>\d+)$`},
+			},
+			wantErr: false,
+		},
+		{
+			name: "part pattern without a part group",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				PartPatterns:          []string{`_seg\d+$`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "native concatenation",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				PartMinScore:          1,
+				ConcatBackend:         "native",
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown concatenation backend",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				ConcatBackend:         "sox",
+			},
+			wantErr: true,
+		},
+		{
+			name: "relative endpoint",
+			cfg: Config{
+				MaxResults:            10,
+				AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+				SearchURL:             "/advancedsearch.php",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -111,3 +374,20 @@ func TestConfigValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigValidateReportsFirstInvalidURL(t *testing.T) {
+	cfg := Config{
+		MaxResults:            10,
+		AudioFormatPreference: []archive.AudioFormat{archive.MP3},
+		PartMinScore:          1,
+		SearchURL:             "search",
+		MetadataURL:           "metadata",
+		S3URL:                 "s3",
+	}
+	for range 10 {
+		err := cfg.Validate()
+		if err == nil || !strings.HasPrefix(err.Error(), "SearchURL ") {
+			t.Fatalf("Expected SearchURL error, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Done      State = "done"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+)
+
+type FileState string
+
+const (
+	FilePending     FileState = "pending"
+	FileDownloading FileState = "downloading"
+	FileDone        FileState = "done"
+	FileSkipped     FileState = "skipped"
+	FileFailed      FileState = "failed"
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job already finished")
+	// ErrCancelled and ErrShutdown are the causes of a job's context when
+	// Cancel stops it and when the manager's context ends. Only a job
+	// stopped by shutdown is resumed, so only it should leave work behind.
+	ErrCancelled = errors.New("job cancelled")
+	ErrShutdown  = errors.New("job manager shut down")
+)
+
+type (
+	FileProgress struct {
+		Name  string    `json:"name"`
+		State FileState `json:"state"`
+		Bytes int64     `json:"bytes"`
+		Total int64     `json:"total,omitempty"`
+		Error string    `json:"error,omitempty"`
+	}
+	Job struct {
+		ID         string          `json:"id"`
+		Identifier string          `json:"identifier"`
+		State      State           `json:"state"`
+		Params     json.RawMessage `json:"params,omitempty"`
+		Files      []FileProgress  `json:"files,omitempty"`
+		Result     json.RawMessage `json:"result,omitempty"`
+		Error      string          `json:"error,omitempty"`
+		CreatedAt  time.Time       `json:"created_at"`
+		UpdatedAt  time.Time       `json:"updated_at"`
+	}
+	Updater interface {
+		SetFiles(files []FileProgress)
+		SetFileProgress(name string, bytes, total int64)
+		SetFileState(name string, state FileState, err error)
+	}
+	Runner  func(ctx context.Context, job Job, update Updater) (any, error)
+	Manager struct {
+		ctx       context.Context
+		statePath string
+		run       Runner
+		slots     chan struct{}
+
+		mu      sync.Mutex
+		jobs    map[string]*Job
+		cancels map[string]context.CancelCauseFunc
+		wg      sync.WaitGroup
+	}
+	stateFile struct {
+		Jobs []*Job `json:"jobs"`
+	}
+)
+
+func (s State) Finished() bool {
+	return s == Done || s == Failed || s == Cancelled
+}
+
+// NewManager loads any jobs persisted at statePath and resumes those that were
+// queued or running when the previous process stopped. Jobs run until ctx is
+// done; shutting down that way leaves their persisted state untouched so they
+// are picked up again on the next start.
+func NewManager(ctx context.Context, statePath string, workers int, run Runner) (*Manager, error) {
+	m := &Manager{
+		ctx:       ctx,
+		statePath: statePath,
+		run:       run,
+		slots:     make(chan struct{}, max(workers, 1)),
+		jobs:      make(map[string]*Job),
+		cancels:   make(map[string]context.CancelCauseFunc),
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	var resume []*Job
+	for _, job := range m.jobs {
+		if !job.State.Finished() {
+			job.State = Queued
+			resume = append(resume, job)
+		}
+	}
+	sort.Slice(resume, func(i, j int) bool { return resume[i].CreatedAt.Before(resume[j].CreatedAt) })
+	for _, job := range resume {
+		m.start(job)
+	}
+
+	return m, nil
+}
+
+func (m *Manager) Submit(identifier string, params any) (Job, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to encode job parameters: %w", err)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:         id,
+		Identifier: identifier,
+		State:      Queued,
+		Params:     raw,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = job
+	err = m.saveLocked()
+	snapshot := job.clone()
+	m.mu.Unlock()
+	if err != nil {
+		return Job{}, err
+	}
+
+	m.start(job)
+	return snapshot, nil
+}
+
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return job.clone(), nil
+}
+
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, job.clone())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if job.State.Finished() {
+		return job.clone(), fmt.Errorf("%w: %s is %s", ErrFinished, id, job.State)
+	}
+
+	if cancel, ok := m.cancels[id]; ok {
+		cancel(ErrCancelled)
+	}
+	job.State = Cancelled
+	job.UpdatedAt = time.Now().UTC()
+	return job.clone(), m.saveLocked()
+}
+
+// Wait blocks until every started job has returned.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Manager) start(job *Job) {
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(m.ctx))
+	stop := context.AfterFunc(m.ctx, func() { cancel(ErrShutdown) })
+
+	m.mu.Lock()
+	m.cancels[job.ID] = cancel
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer stop()
+		defer cancel(nil)
+
+		select {
+		case m.slots <- struct{}{}:
+			defer func() { <-m.slots }()
+		case <-ctx.Done():
+			m.finish(job, nil, ctx.Err())
+			return
+		}
+
+		m.mu.Lock()
+		if job.State != Queued {
+			m.mu.Unlock()
+			return
+		}
+		job.State = Running
+		job.UpdatedAt = time.Now().UTC()
+		_ = m.saveLocked()
+		snapshot := job.clone()
+		m.mu.Unlock()
+
+		result, err := m.run(ctx, snapshot, &updater{m: m, job: job})
+		m.finish(job, result, err)
+	}()
+}
+
+func (m *Manager) finish(job *Job, result any, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.cancels, job.ID)
+
+	if job.State == Cancelled {
+		_ = m.saveLocked()
+		return
+	}
+	if m.ctx.Err() != nil {
+		return
+	}
+
+	if result != nil {
+		if raw, marshalErr := json.Marshal(result); marshalErr == nil {
+			job.Result = raw
+		}
+	}
+	if err != nil {
+		job.State = Failed
+		job.Error = err.Error()
+	} else {
+		job.State = Done
+	}
+	job.UpdatedAt = time.Now().UTC()
+	_ = m.saveLocked()
+}
+
+func (m *Manager) load() error {
+	data, err := os.ReadFile(m.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read job state: %w", err)
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse job state %s: %w", m.statePath, err)
+	}
+	for _, job := range state.Jobs {
+		m.jobs[job.ID] = job
+	}
+	return nil
+}
+
+func (m *Manager) saveLocked() error {
+	state := stateFile{Jobs: make([]*Job, 0, len(m.jobs))}
+	for _, job := range m.jobs {
+		state.Jobs = append(state.Jobs, job)
+	}
+	sort.Slice(state.Jobs, func(i, j int) bool { return state.Jobs[i].CreatedAt.Before(state.Jobs[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create job state directory: %w", err)
+	}
+
+	tmpPath := m.statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write job state: %w", err)
+	}
+	if err := os.Rename(tmpPath, m.statePath); err != nil {
+		return fmt.Errorf("failed to replace job state: %w", err)
+	}
+	return nil
+}
+
+func (j *Job) clone() Job {
+	c := *j
+	c.Files = append([]FileProgress(nil), j.Files...)
+	return c
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type updater struct {
+	m   *Manager
+	job *Job
+}
+
+func (u *updater) SetFiles(files []FileProgress) {
+	u.m.mu.Lock()
+	defer u.m.mu.Unlock()
+
+	u.job.Files = append([]FileProgress(nil), files...)
+	u.job.UpdatedAt = time.Now().UTC()
+	_ = u.m.saveLocked()
+}
+
+func (u *updater) SetFileProgress(name string, bytes, total int64) {
+	u.m.mu.Lock()
+	defer u.m.mu.Unlock()
+
+	if file := u.file(name); file != nil {
+		file.State = FileDownloading
+		file.Bytes = bytes
+		if total > 0 {
+			file.Total = total
+		}
+	}
+}
+
+func (u *updater) SetFileState(name string, state FileState, err error) {
+	u.m.mu.Lock()
+	defer u.m.mu.Unlock()
+
+	file := u.file(name)
+	if file == nil {
+		return
+	}
+	file.State = state
+	if err != nil {
+		file.Error = err.Error()
+	}
+	if (state == FileDone || state == FileSkipped) && file.Total > 0 {
+		file.Bytes = file.Total
+	}
+	u.job.UpdatedAt = time.Now().UTC()
+	_ = u.m.saveLocked()
+}
+
+func (u *updater) file(name string) *FileProgress {
+	for i := range u.job.Files {
+		if u.job.Files[i].Name == name {
+			return &u.job.Files[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitForState(t *testing.T, m *Manager, id string, want State) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if job.State == want {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, _ := m.Get(id)
+	t.Fatalf("Expected job %s to reach %s, got %s", id, want, job.State)
+	return job
+}
+
+func TestManagerRunsJob(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "jobs.json")
+	run := func(ctx context.Context, job Job, update Updater) (any, error) {
+		update.SetFiles([]FileProgress{{Name: "a.mp3", State: FilePending, Total: 10}})
+		update.SetFileProgress("a.mp3", 5, 10)
+		update.SetFileState("a.mp3", FileDone, nil)
+		return map[string]string{"identifier": job.Identifier}, nil
+	}
+
+	m, err := NewManager(context.Background(), statePath, 1, run)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	job, err := m.Submit("item", map[string]string{"identifier": "item"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	done := waitForState(t, m, job.ID, Done)
+	if len(done.Files) != 1 || done.Files[0].Bytes != 10 || done.Files[0].State != FileDone {
+		t.Errorf("Unexpected file progress: %+v", done.Files)
+	}
+	if string(done.Result) != `{"identifier":"item"}` {
+		t.Errorf("Unexpected result: %s", done.Result)
+	}
+}
+
+func TestManagerRecordsFailure(t *testing.T) {
+	run := func(ctx context.Context, job Job, update Updater) (any, error) {
+		return nil, errors.New("boom")
+	}
+
+	m, err := NewManager(context.Background(), filepath.Join(t.TempDir(), "jobs.json"), 1, run)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	job, err := m.Submit("item", nil)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	failed := waitForState(t, m, job.ID, Failed)
+	if failed.Error != "boom" {
+		t.Errorf("Expected error 'boom', got '%s'", failed.Error)
+	}
+}
+
+func TestManagerCancel(t *testing.T) {
+	started := make(chan struct{})
+	cause := make(chan error, 1)
+	run := func(ctx context.Context, job Job, update Updater) (any, error) {
+		close(started)
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+		return nil, ctx.Err()
+	}
+
+	m, err := NewManager(context.Background(), filepath.Join(t.TempDir(), "jobs.json"), 1, run)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	job, err := m.Submit("item", nil)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	<-started
+
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	m.Wait()
+	if err := <-cause; !errors.Is(err, ErrCancelled) {
+		t.Errorf("Expected ErrCancelled as the cause, got %v", err)
+	}
+
+	cancelled := waitForState(t, m, job.ID, Cancelled)
+	if cancelled.Error != "" {
+		t.Errorf("Expected no error on cancelled job, got '%s'", cancelled.Error)
+	}
+
+	if _, err := m.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Expected ErrFinished cancelling a finished job, got %v", err)
+	}
+
+	if _, err := m.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestManagerResumesAfterRestart(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "jobs.json")
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	cause := make(chan error, 1)
+	blocking := func(ctx context.Context, job Job, update Updater) (any, error) {
+		close(started)
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+		return nil, ctx.Err()
+	}
+
+	first, err := NewManager(ctx, statePath, 1, blocking)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	job, err := first.Submit("item", map[string]string{"identifier": "item"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	<-started
+	shutdown()
+	first.Wait()
+	if err := <-cause; !errors.Is(err, ErrShutdown) {
+		t.Errorf("Expected ErrShutdown as the cause, got %v", err)
+	}
+
+	resumed := make(chan map[string]string, 1)
+	run := func(ctx context.Context, job Job, update Updater) (any, error) {
+		var params map[string]string
+		if err := json.Unmarshal(job.Params, &params); err != nil {
+			return nil, err
+		}
+		resumed <- params
+		return nil, nil
+	}
+
+	second, err := NewManager(context.Background(), statePath, 1, run)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	select {
+	case params := <-resumed:
+		if params["identifier"] != "item" {
+			t.Errorf("Expected persisted params, got %v", params)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected job to resume after restart")
+	}
+
+	waitForState(t, second, job.ID, Done)
+	if len(second.List()) != 1 {
+		t.Errorf("Expected 1 job after restart, got %d", len(second.List()))
+	}
+}
@@ -0,0 +1,106 @@
+package safepath
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrUnsafePath = errors.New("unsafe path")
+
+// Join resolves name beneath root. Names use forward slashes, as archive.org
+// file names do, and may contain subdirectories; absolute names, empty or
+// dot segments, backslashes and anything else that could resolve outside root
+// are rejected. Existing symlinks along the way are followed and must also
+// stay inside root.
+func Join(root string, name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve root %s: %w", root, err)
+	}
+
+	path := filepath.Join(absRoot, filepath.FromSlash(name))
+	if !within(absRoot, path) {
+		return "", fmt.Errorf("%w: %q escapes %s", ErrUnsafePath, name, root)
+	}
+
+	if err := checkSymlinks(absRoot, path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// MkdirAll creates the parent directories of a path returned by Join.
+func MkdirAll(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return nil
+}
+
+func validateName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: empty name", ErrUnsafePath)
+	case strings.ContainsRune(name, 0):
+		return fmt.Errorf("%w: %q contains a NUL byte", ErrUnsafePath, name)
+	case strings.Contains(name, `\`):
+		return fmt.Errorf("%w: %q contains a backslash", ErrUnsafePath, name)
+	case strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "":
+		return fmt.Errorf("%w: %q is absolute", ErrUnsafePath, name)
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		switch segment {
+		case "", ".", "..":
+			return fmt.Errorf("%w: %q contains an empty or relative segment", ErrUnsafePath, name)
+		}
+	}
+	return nil
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func checkSymlinks(root, path string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to resolve root %s: %w", root, err)
+	}
+
+	existing := path
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing || !within(root, parent) {
+			return nil
+		}
+		existing = parent
+	}
+
+	realPath, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", existing, err)
+	}
+	if realPath != realRoot && !within(realRoot, realPath) {
+		return fmt.Errorf("%w: %s resolves outside %s", ErrUnsafePath, existing, root)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package safepath
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain file", input: "track01.flac", want: filepath.Join(root, "track01.flac")},
+		{name: "nested file", input: "disc1/track01.flac", want: filepath.Join(root, "disc1", "track01.flac")},
+		{name: "dots inside name", input: "show..final.mp3", want: filepath.Join(root, "show..final.mp3")},
+		{name: "parent traversal", input: "../../etc/passwd", wantErr: true},
+		{name: "nested traversal", input: "disc1/../../escape.mp3", wantErr: true},
+		{name: "current directory segment", input: "./track.mp3", wantErr: true},
+		{name: "absolute", input: "/etc/passwd", wantErr: true},
+		{name: "backslash", input: `..\escape.mp3`, wantErr: true},
+		{name: "empty segment", input: "disc1//track.mp3", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+		{name: "dot", input: ".", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Join(root, tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsafePath) {
+					t.Errorf("Join(%q) error = %v, want ErrUnsafePath", tt.input, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Join(%q) failed: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Join(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinRejectsSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	if _, err := Join(root, "link/track.mp3"); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Expected ErrUnsafePath through symlink, got %v", err)
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	root := t.TempDir()
+
+	path, err := Join(root, "disc2/side_a/track.mp3")
+	if err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	if err := MkdirAll(path); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(root, "disc2", "side_a"))
+	if err != nil || !info.IsDir() {
+		t.Errorf("Expected nested directory to exist, stat returned: %v", err)
+	}
+}